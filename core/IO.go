@@ -3,6 +3,7 @@ package core
 import (
 	"encoding/json"
 	"io"
+	"math"
 	"net/http"
 )
 
@@ -95,3 +96,80 @@ func Flush() Spec {
 		},
 	}
 }
+
+// Respond writes the status, headers and body of an HTTP response. A string
+// body is written as it is, a null body is not written, and any other body is
+// written as JSON.
+func Respond() Spec {
+	return Spec{
+		Name: "respond",
+		Inputs: []Pin{
+			Pin{"writer", WRITER},
+			Pin{"status", NUMBER},
+			Pin{"headers", OBJECT},
+			Pin{"body", ANY},
+		},
+		Outputs: []Pin{
+			Pin{"writer", WRITER},
+		},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+
+			writer, ok := in[0].(http.ResponseWriter)
+			if !ok {
+				out[0] = NewError("writer must implement http.ResponseWriter")
+				return nil
+			}
+
+			status, ok := in[1].(float64)
+			if !ok || status < 100 || status > 999 || status != math.Floor(status) {
+				out[0] = NewError("status must be a whole number from 100 to 999")
+				return nil
+			}
+
+			headers := in[2].(map[string]interface{})
+			header := make(http.Header)
+			for k, v := range headers {
+				value, ok := httpValue(v)
+				if !ok {
+					out[0] = NewError("header " + k + " must be a string, number or boolean")
+					return nil
+				}
+				header.Set(k, value)
+			}
+
+			var body []byte
+			switch t := in[3].(type) {
+			case nil:
+			case string:
+				body = []byte(t)
+			default:
+				var err error
+				body, err = json.Marshal(t)
+				if err != nil {
+					out[0] = NewError("could not marshal body")
+					return nil
+				}
+				writer.Header().Set("Content-Type", "application/json")
+			}
+
+			// headers are set after the body's content type, so that they
+			// can replace it
+			for k, v := range header {
+				writer.Header()[k] = v
+			}
+
+			writer.WriteHeader(int(status))
+			if body != nil {
+				if _, err := writer.Write(body); err != nil {
+					out[0] = NewError("could not write data to writer")
+					return nil
+				}
+			}
+
+			out[0] = writer
+
+			return nil
+
+		},
+	}
+}
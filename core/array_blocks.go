@@ -7,11 +7,7 @@ func Head() Spec {
 		Inputs:  []Pin{Pin{"in", ARRAY}},
 		Outputs: []Pin{Pin{"head", ANY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[0].([]interface{})
-			if !ok {
-				out[0] = NewError("head requires an array")
-				return nil
-			}
+			arr := in[0].([]interface{})
 			if len(arr) == 0 {
 				out[0] = NewError("zero length array passed to head")
 				return nil
@@ -29,11 +25,7 @@ func Tail() Spec {
 		Inputs:  []Pin{Pin{"in", ARRAY}},
 		Outputs: []Pin{Pin{"tail", ARRAY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[0].([]interface{})
-			if !ok {
-				out[0] = NewError("tail requires an array")
-				return nil
-			}
+			arr := in[0].([]interface{})
 			if len(arr) == 0 {
 				out[0] = NewError("zero length array passed to tail")
 				return nil
@@ -51,11 +43,7 @@ func Last() Spec {
 		Inputs:  []Pin{Pin{"in", ARRAY}},
 		Outputs: []Pin{Pin{"last", ANY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[0].([]interface{})
-			if !ok {
-				out[0] = NewError("last requires an array")
-				return nil
-			}
+			arr := in[0].([]interface{})
 			if len(arr) == 0 {
 				out[0] = NewError("zero length array passed to last")
 				return nil
@@ -73,11 +61,7 @@ func Init() Spec {
 		Inputs:  []Pin{Pin{"in", ARRAY}},
 		Outputs: []Pin{Pin{"init", ARRAY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[0].([]interface{})
-			if !ok {
-				out[0] = NewError("init requires an array")
-				return nil
-			}
+			arr := in[0].([]interface{})
 			if len(arr) == 0 {
 				out[0] = NewError("zero length array passed to init")
 				return nil
@@ -95,11 +79,7 @@ func Append() Spec {
 		Inputs:  []Pin{Pin{"element", ANY}, Pin{"array", ARRAY}},
 		Outputs: []Pin{Pin{"array", ARRAY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[1].([]interface{})
-			if !ok {
-				out[0] = NewError("Append requires an array")
-				return nil
-			}
+			arr := in[1].([]interface{})
 			out[0] = append(arr, in[0])
 			return nil
 		},
@@ -112,11 +92,7 @@ func Len() Spec {
 		Inputs:  []Pin{Pin{"in", ARRAY}},
 		Outputs: []Pin{Pin{"out", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[0].([]interface{})
-			if !ok {
-				out[0] = NewError("len requires an array")
-				return nil
-			}
+			arr := in[0].([]interface{})
 			out[0] = float64(len(arr))
 			return nil
 		},
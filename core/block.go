@@ -5,7 +5,8 @@ import (
 	"time"
 )
 
-// NewBlock creates a new block from a spec
+// NewBlock creates a new block from a spec. Every block has an implicit error
+// output, appended after the outputs listed in the spec.
 func NewBlock(s Spec) *Block {
 	var in []Input
 	var out []Output
@@ -19,7 +20,7 @@ func NewBlock(s Spec) *Block {
 		})
 	}
 
-	for _, v := range s.Outputs {
+	for _, v := range append(s.Outputs, ErrorPin) {
 		out = append(out, Output{
 			Name:        v.Name,
 			Type:        v.Type,
@@ -28,6 +29,7 @@ func NewBlock(s Spec) *Block {
 	}
 
 	return &Block{
+		stats: newBlockStats(len(in), len(out)),
 		state: BlockState{
 			make(MessageMap),
 			make(MessageMap),
@@ -41,10 +43,14 @@ func NewBlock(s Spec) *Block {
 			InterruptChan: make(chan Interrupt),
 		},
 		kernel:     s.Kernel,
+		preempt:    s.Preempt,
+		cleanup:    s.Cleanup,
 		sourceType: s.Source,
 		Monitor:    make(chan MonitorMessage, 1),
 		lastCrank:  time.Now(),
 		done:       make(chan struct{}),
+		taps:       make(map[ManifestPair]chan Message),
+		inputs:     inputSync{latest: make(MessageMap), next: make(MessageMap)},
 	}
 }
 
@@ -58,6 +64,19 @@ func (b *Block) Serve() {
 
 		b.routing.RLock()
 		for {
+			// an interrupt that arrived as a preemptible kernel finished
+			if b.pending != nil {
+				interrupt = b.pending
+				b.pending = nil
+				break
+			}
+
+			// a paused block does nothing but wait for interrupts
+			if b.paused {
+				interrupt = <-b.routing.InterruptChan
+				break
+			}
+
 			interrupt = b.receive()
 			if interrupt != nil {
 				break
@@ -78,6 +97,7 @@ func (b *Block) Serve() {
 		b.routing.RUnlock()
 		b.routing.Lock()
 		if ok := interrupt(); !ok {
+			b.release()
 			b.routing.Unlock()
 			return
 		}
@@ -100,6 +120,7 @@ func (b *Block) exportInput(id RouteIndex) (*Input, error) {
 		},
 		C:    b.routing.Inputs[id].C,
 		Name: b.routing.Inputs[id].Name,
+		Type: b.routing.Inputs[id].Type,
 	}, nil
 
 }
@@ -137,6 +158,13 @@ func (b *Block) SetInput(id RouteIndex, v *InputValue) error {
 			return true
 		}
 
+		if b.typeCheck && v != nil {
+			if err := b.checkType(int(id), false, v.Data); err != nil {
+				returnVal <- err
+				return true
+			}
+		}
+
 		// if our receive() has already set the inputValue for the kernel
 		// then delete the value out of the input map and use the new one
 		if _, ok := b.state.inputValues[id]; ok {
@@ -227,20 +255,156 @@ func (b *Block) Disconnect(id RouteIndex, c Connection) error {
 		}
 
 		delete(b.routing.Outputs[id].Connections, c)
+		delete(b.taps, ManifestPair{int(id), c})
 		returnVal <- nil
 		return true
 	}
 	return <-returnVal
 }
 
+// SetID sets the id the block reports in its ErrorMessages and TypeErrors.
+func (b *Block) SetID(id int) {
+	b.routing.InterruptChan <- func() bool {
+		b.id = id
+		return true
+	}
+}
+
+// SetTypeCheck enables or disables checking messages against the types of the
+// block's pins. When enabled, messages that don't match their pin's type are
+// discarded, and their TypeError is sent on the block's Monitor and emitted on
+// the error output.
+func (b *Block) SetTypeCheck(on bool) {
+	b.routing.InterruptChan <- func() bool {
+		b.typeCheck = on
+		return true
+	}
+}
+
+// Pause stops the block from running its kernel. Unlike Stop, a paused block
+// keeps its state and continues to accept interrupts. Resume continues from
+// where the block was paused.
+func (b *Block) Pause() {
+	b.routing.InterruptChan <- func() bool {
+		b.paused = true
+		return true
+	}
+}
+
+// Resume continues running a paused block.
+func (b *Block) Resume() {
+	b.routing.InterruptChan <- func() bool {
+		b.paused = false
+		return true
+	}
+}
+
+// Replay queues inputs, one message per input route, for the block to run its
+// kernel on again. Replayed inputs are used at the start of a crank, before any
+// messages are received for it, so they never mix with messages from the
+// block's connections. Inputs that are set to a value keep their value.
+func (b *Block) Replay(inputs []Message) error {
+	returnVal := make(chan error, 1)
+	b.routing.InterruptChan <- func() bool {
+		if len(inputs) != len(b.routing.Inputs) {
+			returnVal <- errors.New("replay does not match the block's inputs")
+			return true
+		}
+		b.replays = append(b.replays, inputs)
+		returnVal <- nil
+		return true
+	}
+	return <-returnVal
+}
+
+// checkType returns a TypeError if m is not a valid message for the input, or
+// output, at route.
+func (b *Block) checkType(route int, output bool, m Message) error {
+	name, t := b.routing.Inputs[route].Name, b.routing.Inputs[route].Type
+	if output {
+		name, t = b.routing.Outputs[route].Name, b.routing.Outputs[route].Type
+	}
+	if t.Accepts(m) {
+		return nil
+	}
+	return &TypeError{
+		Block:    b.id,
+		Route:    route,
+		Pin:      name,
+		Output:   output,
+		Expected: t,
+		Actual:   TypeOf(m),
+	}
+}
+
+// checkKernelInputs returns a TypeError for the first input that doesn't hold
+// the type of its pin, whether or not the block checks types. Kernels rely on
+// this, and don't check the types of their inputs themselves. Numbers are
+// converted to float64.
+func (b *Block) checkKernelInputs() error {
+	for id, input := range b.routing.Inputs {
+		m := b.state.inputValues[RouteIndex(id)]
+		if input.Type == ANY {
+			continue
+		}
+		if TypeOf(m) != input.Type {
+			return &TypeError{
+				Block:    b.id,
+				Route:    id,
+				Pin:      input.Name,
+				Expected: input.Type,
+				Actual:   TypeOf(m),
+			}
+		}
+		if input.Type == NUMBER {
+			b.state.inputValues[RouteIndex(id)] = toFloat(m)
+		}
+	}
+	return nil
+}
+
+// rejectInput drops a message that doesn't match the type of its input. The
+// TypeError is sent on the block's Monitor, and is emitted on the error output
+// before the block's next crank.
+func (b *Block) rejectInput(route int, m Message, err error) {
+	b.Monitor <- MonitorMessage{
+		BI_ERROR,
+		err,
+	}
+	b.stats.count(&b.stats.Errors)
+	if b.rejected != nil {
+		return
+	}
+	b.rejected = b.newErrorMessage(b.routing.Inputs[route].Name, err)
+	b.rejected.Inputs[route] = Copy(m)
+}
+
+// emitRejected starts a crank that emits the rejected input on the error
+// output without running the kernel.
+func (b *Block) emitRejected() {
+	b.state.outputValues[RouteIndex(len(b.routing.Outputs)-1)] = b.rejected
+	b.state.Processed = true
+	b.rejected = nil
+	b.rejecting = true
+}
+
 func (b *Block) Reset() {
+	for k, _ := range b.inputs.next {
+		delete(b.inputs.next, k)
+	}
 	b.crank()
 
 	// reset block's state as well. currently this only applies to a handful of
 	// blocks, like GET and first.
+	b.release()
+	b.replays = nil
+	b.rejected = nil
 	for k, _ := range b.state.internalValues {
 		delete(b.state.internalValues, k)
 	}
+	for k, _ := range b.inputs.latest {
+		delete(b.inputs.latest, k)
+	}
 
 	// if there are any messages on the input channels, flush them.
 	// note: all blocks that are sending to this block MUST BE IN A
@@ -257,6 +421,13 @@ func (b *Block) Reset() {
 	return
 }
 
+// release lets the kernel release what it holds in its internal state.
+func (b *Block) release() {
+	if b.cleanup != nil {
+		b.cleanup(b.state.internalValues)
+	}
+}
+
 func (b *Block) Stop() {
 	b.routing.InterruptChan <- func() bool {
 		return false
@@ -267,6 +438,37 @@ func (b *Block) Stop() {
 
 // wait and listen for all kernel inputs to be filled.
 func (b *Block) receive() Interrupt {
+	defer b.stats.wait(&b.stats.Receiving, time.Now())
+
+	// an input rejected by type checking is emitted on the error output in a
+	// crank of its own, which keeps the inputs received so far
+	if b.rejecting {
+		return nil
+	}
+	if b.rejected != nil && !b.state.Processed {
+		b.emitRejected()
+		return nil
+	}
+
+	if len(b.state.inputValues) == 0 && len(b.replays) > 0 {
+		for id, input := range b.routing.Inputs {
+			if input.Value != nil {
+				b.state.inputValues[RouteIndex(id)] = Copy(input.Value.Data)
+			} else {
+				b.state.inputValues[RouteIndex(id)] = b.replays[0][id]
+			}
+		}
+		b.replays = b.replays[1:]
+		return nil
+	}
+
+	switch b.inputs.mode {
+	case SYNC_ANY:
+		return b.receiveAny()
+	case SYNC_WINDOW:
+		return b.receiveWindow()
+	}
+
 	for id, input := range b.routing.Inputs {
 		b.Monitor <- MonitorMessage{
 			BI_INPUT,
@@ -285,6 +487,15 @@ func (b *Block) receive() Interrupt {
 
 		select {
 		case m := <-input.C:
+			m = b.untrace(input.Name, m)
+			if b.typeCheck {
+				if err := b.checkType(id, false, m); err != nil {
+					b.rejectInput(id, m, err)
+					b.emitRejected()
+					return nil
+				}
+			}
+			b.stats.count(&b.stats.In[id])
 			b.state.inputValues[RouteIndex(id)] = m
 		case f := <-b.routing.InterruptChan:
 			return f
@@ -304,6 +515,13 @@ func (b *Block) process() Interrupt {
 		return nil
 	}
 
+	if err := b.checkKernelInputs(); err != nil {
+		pin := b.routing.Inputs[err.(*TypeError).Route].Name
+		b.state.outputValues[RouteIndex(len(b.routing.Outputs)-1)] = b.newErrorMessage(pin, err)
+		b.state.Processed = true
+		return nil
+	}
+
 	// if this kernel relies on an external shared state then we need to
 	// block until an interrupt connects us to a shared external state.
 
@@ -324,16 +542,29 @@ func (b *Block) process() Interrupt {
 	}
 
 	// run the kernel
+	interrupts := b.routing.InterruptChan
+	var stop func() Interrupt
+	if b.preempt {
+		interrupts, stop = b.preemptible()
+	}
+
+	start := time.Now()
 	interrupt := b.kernel(b.state.inputValues,
 		b.state.outputValues,
 		b.state.internalValues,
 		b.routing.Source,
-		b.routing.InterruptChan)
+		interrupts)
+
+	var pending Interrupt
+	if stop != nil {
+		pending = stop()
+	}
 
 	if interrupt != nil {
 		if b.sourceType != NONE && b.sourceType != SERVER {
 			b.routing.Source.Unlock()
 		}
+		b.pending = pending
 		return interrupt
 	}
 
@@ -341,26 +572,112 @@ func (b *Block) process() Interrupt {
 		b.routing.Source.Unlock()
 	}
 
+	b.stats.kernel(start)
+	b.trace.kernel = time.Since(start)
+	b.startTrace()
+	b.routeErrors()
+
 	b.state.Processed = true
 
-	return nil
+	return pending
+}
+
+// routeErrors moves any errors the kernel has produced onto the block's error
+// output, so that they are not delivered downstream as data. Only the first
+// error of a crank is emitted.
+func (b *Block) routeErrors() {
+	errorRoute := RouteIndex(len(b.routing.Outputs) - 1)
+
+	if m, ok := b.state.outputValues[ErrorRoute]; ok {
+		delete(b.state.outputValues, ErrorRoute)
+		b.state.outputValues[errorRoute] = b.newErrorMessage(ErrorPin.Name, m)
+	}
+
+	for id, out := range b.routing.Outputs[:errorRoute] {
+		m, ok := b.state.outputValues[RouteIndex(id)]
+		if !ok {
+			continue
+		}
+		// ErrorMessages that are being passed along as data have
+		// already been routed.
+		if _, ok := m.(*ErrorMessage); ok || TypeOf(m) != ERROR {
+			continue
+		}
+		delete(b.state.outputValues, RouteIndex(id))
+		if _, ok := b.state.outputValues[errorRoute]; !ok {
+			b.state.outputValues[errorRoute] = b.newErrorMessage(out.Name, m)
+		}
+	}
+}
+
+// newErrorMessage wraps an error written to the named pin with the inputs
+// that produced it.
+func (b *Block) newErrorMessage(pin string, m Message) *ErrorMessage {
+	inputs := make([]Message, len(b.routing.Inputs))
+	for id, _ := range inputs {
+		inputs[id] = Copy(b.state.inputValues[RouteIndex(id)])
+	}
+	return &ErrorMessage{
+		Block:  b.id,
+		Pin:    pin,
+		Text:   errorText(m),
+		Inputs: inputs,
+		Time:   time.Now(),
+	}
 }
 
 // broadcast the kernel output to all connections on all outputs.
 func (b *Block) broadcast() Interrupt {
+	defer b.stats.wait(&b.stats.Broadcasting, time.Now())
+
 	for id, out := range b.routing.Outputs {
 		b.Monitor <- MonitorMessage{
 			BI_OUTPUT,
 			id,
 		}
 
+		// skip outputs that were fully delivered before an interrupt
+		done := ManifestPair{id, nil}
+		if _, ok := b.state.manifest[done]; ok {
+			continue
+		}
+
 		// if the output key is not present in the output map, then we
 		// don't deliver any message
-		_, ok := b.state.outputValues[RouteIndex(id)]
+		v, ok := b.state.outputValues[RouteIndex(id)]
 		if !ok {
 			continue
 		}
 
+		// messages of the wrong type are emitted on the error output
+		// rather than delivered
+		errorRoute := RouteIndex(len(b.routing.Outputs) - 1)
+		if b.typeCheck && RouteIndex(id) != errorRoute {
+			if err := b.checkType(id, true, v); err != nil {
+				b.Monitor <- MonitorMessage{
+					BI_ERROR,
+					err,
+				}
+				delete(b.state.outputValues, RouteIndex(id))
+				if _, ok := b.state.outputValues[errorRoute]; !ok {
+					b.state.outputValues[errorRoute] = b.newErrorMessage(out.Name, err)
+				}
+				continue
+			}
+		}
+
+		// errors that nothing is listening for are reported to the
+		// monitor instead of blocking the block.
+		if RouteIndex(id) == errorRoute && len(out.Connections) == 0 {
+			b.Monitor <- MonitorMessage{
+				BI_ERROR,
+				v,
+			}
+			b.stats.count(&b.stats.Errors)
+			delete(b.state.outputValues, RouteIndex(id))
+			continue
+		}
+
 		// if there no connection for this output then wait until there
 		// is one. that means we have to wait for an interrupt.
 		if len(out.Connections) == 0 {
@@ -379,19 +696,41 @@ func (b *Block) broadcast() Interrupt {
 			}
 
 			select {
-			case c <- b.state.outputValues[RouteIndex(id)]:
+			case c <- b.wrap(out.Name, v):
 				// set that we have delivered the message.
 				b.state.manifest[m] = struct{}{}
+				b.tap(id, c, v)
 			case f := <-b.routing.InterruptChan:
 				return f
 			}
 		}
+
+		b.state.manifest[done] = struct{}{}
+		b.stats.count(&b.stats.Out[id])
+		if RouteIndex(id) == errorRoute {
+			b.stats.count(&b.stats.Errors)
+		}
 	}
+	b.recordTrace()
 	return nil
 }
 
 // cleanup all block state for this crank of the block
 func (b *Block) crank() {
+	if b.rejecting {
+		// the inputs received before the rejected one stay for the
+		// kernel
+		for k, _ := range b.state.outputValues {
+			delete(b.state.outputValues, k)
+		}
+		for k, _ := range b.state.manifest {
+			delete(b.state.manifest, k)
+		}
+		b.state.Processed = false
+		b.trace = blockTrace{}
+		b.rejecting = false
+		return
+	}
 	for k, _ := range b.state.inputValues {
 		delete(b.state.inputValues, k)
 	}
@@ -402,4 +741,13 @@ func (b *Block) crank() {
 		delete(b.state.manifest, k)
 	}
 	b.state.Processed = false
+	b.trace = blockTrace{}
+	b.inputs.fresh = false
+	b.inputs.deadline = time.Time{}
+	// messages that preempted a kernel that had already finished belong to
+	// the next crank
+	for k, m := range b.inputs.next {
+		b.state.inputValues[k] = m
+		delete(b.inputs.next, k)
+	}
 }
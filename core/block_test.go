@@ -3,9 +3,13 @@ package core
 import (
 	"encoding/json"
 	"log"
+	"math"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/nytlabs/st-core/core/nettest"
 )
 
 func DummyMonitor(mm chan MonitorMessage) {
@@ -225,20 +229,404 @@ func BenchmarkRandomMath(b *testing.B) {
 
 func TestGET(t *testing.T) {
 	log.Println("testing GET")
+	remote := nettest.NewServer()
+	defer remote.Close()
+	remote.Script("/get", nettest.Response{Body: `{"msg": "hello there!"}`})
+
 	lib := GetLibrary()
 	block := NewBlock(lib["GET"])
 	go DummyMonitor(block.Monitor)
 	go block.Serve()
-	headers := make(map[string]string)
+	headers := map[string]interface{}{"X-Test": "yes"}
 	block.SetInput(1, &InputValue{headers})
 	urlRoute, _ := block.GetInput(0)
 	out := make(chan Message)
 	block.Connect(0, out)
-	urlRoute.C <- "http://private-e92ba-stcoretest.apiary-mock.com/get"
+	block.Connect(1, out)
+	urlRoute.C <- remote.URL + "/get"
 	m := <-out
-	if reflect.DeepEqual(m, `{"msg": "hello there!"}`) {
+	if !reflect.DeepEqual(m, `{"msg": "hello there!"}`) {
 		t.Error("didn't get expected output from GET")
 	}
+	if r := remote.Requests(); len(r) != 1 || r[0].Method != "GET" || r[0].Header.Get("X-Test") != "yes" {
+		t.Error("GET sent", r)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	log.Println("testing endpoint")
+	server := NewServer().(*Server)
+	server.SetSourceParameter("host", "127.0.0.1")
+	server.SetSourceParameter("port", "0")
+	go server.Serve()
+	defer server.Stop()
+
+	// endpoint -> respond -> write -> flush -> close, with the request body
+	// as the message that is written
+	library := GetLibrary()
+	blocks := map[string]*Block{}
+	for _, name := range []string{"endpoint", "respond", "write", "flush", "close"} {
+		blocks[name] = NewBlock(library[name])
+		go DummyMonitor(blocks[name].Monitor)
+		go blocks[name].Serve()
+	}
+	if err := blocks["endpoint"].SetSource(server); err != nil {
+		t.Fatal(err)
+	}
+	respond, _ := blocks["respond"].GetInput(0)
+	writer, _ := blocks["write"].GetInput(0)
+	msg, _ := blocks["write"].GetInput(1)
+	flush, _ := blocks["flush"].GetInput(0)
+	closer, _ := blocks["close"].GetInput(0)
+	request := make(chan Message, 1)
+	params := make(chan Message, 1)
+	blocks["endpoint"].Connect(0, request)
+	blocks["endpoint"].Connect(1, respond.C)
+	blocks["endpoint"].Connect(2, msg.C)
+	blocks["endpoint"].Connect(3, params)
+	blocks["respond"].Connect(0, writer.C)
+	blocks["write"].Connect(0, flush.C)
+	blocks["flush"].Connect(0, closer.C)
+	blocks["respond"].SetInput(1, &InputValue{201.0})
+	blocks["respond"].SetInput(2, &InputValue{map[string]interface{}{"X-Test": "yes", "Content-Type": "application/json"}})
+	blocks["respond"].SetInput(3, &InputValue{nil})
+	blocks["endpoint"].SetInput(1, &InputValue{"post, put"})
+	blocks["endpoint"].SetInput(0, &InputValue{"/users/{id}/"})
+
+	// wait for the endpoint to register with the server
+	registered := func() bool {
+		server.Lock()
+		defer server.Unlock()
+		_, ok := server.routes["POST,PUT /users/{id}"]
+		return ok
+	}
+	for deadline := time.Now().Add(time.Second); !registered(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoint did not register")
+		}
+	}
+
+	for _, miss := range []struct {
+		method, target string
+		status         int
+	}{
+		{"GET", "/users/7", http.StatusMethodNotAllowed},
+		{"POST", "/users", http.StatusNotFound},
+		{"POST", "/users/7/posts", http.StatusNotFound},
+	} {
+		resp, err := nettest.Send(server, miss.method, miss.target, "").Wait(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != miss.status {
+			t.Error(miss.method, miss.target, "responded", resp.Code)
+		}
+		if miss.status == http.StatusMethodNotAllowed && resp.Header().Get("Allow") != "POST, PUT" {
+			t.Error(miss.method, miss.target, "allowed", resp.Header().Get("Allow"))
+		}
+	}
+
+	e := nettest.Send(server, "POST", "/users/7", "hi")
+	resp, err := e.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 201 || resp.Header().Get("X-Test") != "yes" || resp.Body.String() != `"hi"` || !resp.Flushed {
+		t.Error("endpoint responded", resp.Code, resp.Header(), resp.Body.String(), "flushed", resp.Flushed)
+	}
+	r, ok := (<-request).(map[string]interface{})
+	if !ok || r["Method"] != "POST" {
+		t.Error("endpoint emitted request", r)
+	}
+	if p := <-params; !reflect.DeepEqual(p, map[string]interface{}{"id": "7"}) {
+		t.Error("endpoint emitted params", p)
+	}
+}
+
+func TestEndpointQueue(t *testing.T) {
+	log.Println("testing endpoint queue")
+
+	waitFor := func(what string, f func() bool) {
+		for deadline := time.Now().Add(time.Second); !f(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for", what)
+			}
+		}
+	}
+
+	server := NewServer().(*Server)
+	server.SetSourceParameter("host", "127.0.0.1")
+	server.SetSourceParameter("port", "0")
+	server.SetSourceParameter("backlog", "2")
+	server.SetSourceParameter("queueTimeout", "5s")
+	go server.Serve()
+	defer server.Stop()
+	waitFor("server to listen", func() bool { return server.Addr() != nil })
+
+	// an endpoint is busy until the test takes the writer of the request it
+	// is working on
+	sink := make(chan Message)
+	go func() {
+		for range sink {
+		}
+	}()
+	defer close(sink)
+	newEndpoint := func() (*Block, func() Request) {
+		endpoint := NewBlock(GetLibrary()["endpoint"])
+		go DummyMonitor(endpoint.Monitor)
+		go endpoint.Serve()
+		endpoint.SetSource(server)
+		writers := make(chan Message)
+		endpoint.Connect(1, writers)
+		for _, id := range []RouteIndex{0, 2, 3} {
+			endpoint.Connect(id, sink)
+		}
+		endpoint.SetInput(1, &InputValue{""})
+		endpoint.SetInput(0, &InputValue{"work"})
+		// next returns the writer of the next request the endpoint takes
+		next := func() Request {
+			select {
+			case w := <-writers:
+				return w.(Request)
+			case <-time.After(time.Second):
+				t.Fatal("endpoint did not emit a writer")
+			}
+			return Request{}
+		}
+		return endpoint, next
+	}
+	endpoint, next := newEndpoint()
+
+	// taken is true once the endpoint has emitted n requests, and is
+	// waiting for the test to take the writer of the last one
+	taken := func(n uint64) func() bool {
+		return func() bool { return endpoint.Stats().Out[0] == n }
+	}
+
+	// registered is true once n endpoints are registered for the route, and
+	// waiting once n requests are waiting for them
+	registered := func(n int) func() bool {
+		return func() bool {
+			server.Lock()
+			defer server.Unlock()
+			q, ok := server.routes["* /work"]
+			return ok && q.endpoints == n
+		}
+	}
+	waiting := func(n int) func() bool {
+		return func() bool {
+			server.Lock()
+			defer server.Unlock()
+			q, ok := server.routes["* /work"]
+			return ok && q.waiting == n
+		}
+	}
+	waitFor("endpoint to register", registered(1))
+
+	// the first request is taken by the endpoint, the next two wait for it,
+	// and the one after that is turned away
+	exchanges := []*nettest.Exchange{nettest.Send(server, "GET", "/work", "")}
+	waitFor("endpoint to take a request", taken(1))
+	exchanges = append(exchanges, nettest.Send(server, "GET", "/work", ""), nettest.Send(server, "GET", "/work", ""))
+	waitFor("requests to queue", waiting(2))
+	resp, err := nettest.Send(server, "GET", "/work", "").Wait(time.Second)
+	if err != nil || resp.Code != http.StatusServiceUnavailable {
+		t.Fatal("request beyond the backlog was not turned away")
+	}
+
+	// the endpoint stays registered, so every queued request is served, in
+	// whatever order the endpoint takes them
+	for range exchanges {
+		next().Close()
+	}
+	for _, e := range exchanges {
+		resp, err := e.Wait(time.Second)
+		if err != nil || resp.Code != http.StatusOK {
+			t.Error("queued request was not served")
+		}
+	}
+
+	// a request that waits longer than the queue timeout is turned away
+	server.Stop()
+	server.SetSourceParameter("queueTimeout", "50ms")
+	go server.Serve()
+	waitFor("server to listen", func() bool { return server.Addr() != nil })
+	busy := nettest.Send(server, "GET", "/work", "")
+	waitFor("endpoint to take a request", taken(4))
+	resp, err = nettest.Send(server, "GET", "/work", "").Wait(time.Second)
+	if err != nil || resp.Code != http.StatusServiceUnavailable {
+		t.Error("request that timed out was not turned away")
+	}
+	next().Close()
+	if resp, err := busy.Wait(time.Second); err != nil || resp.Code != http.StatusOK {
+		t.Error("request was not served")
+	}
+
+	// endpoints with the same route share it, so stopping one leaves the
+	// route to the other, even once the stopped one is reset
+	other, otherNext := newEndpoint()
+	waitFor("second endpoint to register", registered(2))
+	server.Lock()
+	q := server.routes["* /work"]
+	server.Unlock()
+	endpoint.Stop()
+	endpoint.Reset()
+	server.Lock()
+	if server.routes["* /work"] != q || q.endpoints != 1 {
+		t.Error("route was removed while an endpoint was registered")
+	}
+	server.Unlock()
+	e := nettest.Send(server, "GET", "/work", "")
+	otherNext().Close()
+	if resp, err := e.Wait(time.Second); err != nil || resp.Code != http.StatusOK {
+		t.Error("request was not served by the remaining endpoint")
+	}
+
+	// the route goes with the last of its endpoints
+	other.Stop()
+	waitFor("route to be removed", func() bool {
+		server.Lock()
+		defer server.Unlock()
+		return len(server.routes) == 0
+	})
+}
+
+func TestRoutes(t *testing.T) {
+	log.Println("testing routes")
+
+	for _, bad := range [][2]string{{"a/{}", ""}, {"a/b{c}", ""}, {"{a}/{a}", ""}, {"a//b", ""}, {"a", "GET,"}} {
+		if _, err := parseRoute(bad[0], bad[1]); err == nil {
+			t.Error("parsed", bad)
+		}
+	}
+
+	// the first route is matched before each of the ones after it
+	order := [][2]string{
+		{"users/me", "GET"},
+		{"users/me", ""},
+		{"users/{id}", "GET"},
+		{"{kind}/me", "GET"},
+		{"{kind}/{id}", "*"},
+	}
+	for i := range order {
+		r, _ := parseRoute(order[i][0], order[i][1])
+		if _, ok := r.match(splitPath("/users/me")); !ok {
+			t.Error(r.key(), "did not match /users/me")
+		}
+		for _, later := range order[i+1:] {
+			o, _ := parseRoute(later[0], later[1])
+			if !r.before(o) || o.before(r) {
+				t.Error(r.key(), "is not matched before", o.key())
+			}
+		}
+	}
+}
+
+func TestHTTPRequest(t *testing.T) {
+	log.Println("testing httpRequest")
+
+	remote := nettest.NewServer()
+	defer remote.Close()
+	remote.Script("/json", nettest.Response{
+		Status: http.StatusCreated,
+		Header: map[string]string{"Content-Type": "application/json"},
+		Body:   `{"ok":true}`,
+	})
+	remote.Script("/text", nettest.Response{Body: "plain"})
+	remote.Script("/flaky",
+		nettest.Response{Status: http.StatusServiceUnavailable},
+		nettest.Response{Status: http.StatusBadGateway},
+		nettest.Response{Body: "ok"},
+	)
+	remote.Script("/slow", nettest.Response{Delay: 200 * time.Millisecond})
+	remote.Script("/down", nettest.Response{Status: http.StatusServiceUnavailable})
+
+	httpBackoff = time.Millisecond
+	httpMaxBackoff = 2 * time.Millisecond
+	kernel := GetLibrary()["httpRequest"].Kernel
+	request := func(path, method string, body Message, timeout string, retries float64) MessageMap {
+		out := make(MessageMap)
+		in := MessageMap{
+			0: remote.URL + path,
+			1: method,
+			2: map[string]interface{}{"a": 1.0, "b": []interface{}{"x", "y"}},
+			3: map[string]interface{}{"X-Token": "secret"},
+			4: body,
+			5: timeout,
+			6: retries,
+		}
+		if f := kernel(in, out, make(MessageMap), nil, make(chan Interrupt)); f != nil {
+			t.Fatal("httpRequest returned an interrupt")
+		}
+		return out
+	}
+	last := func() nettest.Request {
+		r := remote.Requests()
+		return r[len(r)-1]
+	}
+
+	out := request("/json?c=z", "post", map[string]interface{}{"k": "v"}, "", 0)
+	if out[0] != 201.0 {
+		t.Error("emitted status", out[0])
+	}
+	if h, _ := out[1].(map[string]interface{}); h["Content-Type"] != "application/json" {
+		t.Error("emitted headers", out[1])
+	}
+	if !reflect.DeepEqual(out[2], map[string]interface{}{"ok": true}) {
+		t.Error("emitted body", out[2])
+	}
+	r := last()
+	if r.Method != "POST" || r.Query.Encode() != "a=1&b=x&b=y&c=z" || r.Body != `{"k":"v"}` ||
+		r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "secret" {
+		t.Error("sent", r)
+	}
+
+	out = request("/text", "", "raw", "", 0)
+	if out[2] != "plain" {
+		t.Error("emitted body", out[2])
+	}
+	if r := last(); r.Method != "GET" || r.Body != "raw" || r.Header.Get("Content-Type") != "" {
+		t.Error("sent", r)
+	}
+
+	// 5xx responses are retried, and the last response is emitted when
+	// there are no retries left
+	out = request("/flaky", "GET", nil, "", 0)
+	if out[0] != 503.0 {
+		t.Error("emitted status", out[0], "without retries")
+	}
+	out = request("/flaky", "GET", nil, "", 5)
+	if out[0] != 200.0 || out[2] != "ok" {
+		t.Error("emitted", out[0], out[2], "after retrying")
+	}
+	if n := len(remote.Requests()); n != 5 {
+		t.Error("made", n, "requests")
+	}
+
+	// without a cap on the backoff these retries would take over a second
+	start := time.Now()
+	out = request("/down", "GET", nil, "", 12)
+	if out[0] != 503.0 || time.Since(start) > time.Second {
+		t.Error("emitted", out[0], "after retrying for", time.Since(start))
+	}
+
+	out = request("/slow", "GET", nil, "50ms", 0)
+	if _, ok := out[0].(error); !ok {
+		t.Error("didn't time out")
+	}
+	out = request("/text", "GET", nil, "soon", 0)
+	if _, ok := out[0].(error); !ok {
+		t.Error("accepted a bad timeout")
+	}
+
+	// an interrupt cancels a request in flight
+	i := make(chan Interrupt, 1)
+	i <- func() bool { return true }
+	in := MessageMap{0: remote.URL + "/slow", 1: "GET", 2: map[string]interface{}{}, 3: map[string]interface{}{}, 4: nil, 5: "", 6: 0.0}
+	start = time.Now()
+	if f := kernel(in, make(MessageMap), make(MessageMap), nil, i); f == nil || time.Since(start) > 150*time.Millisecond {
+		t.Error("didn't return the interrupt")
+	}
 }
 
 func TestParseJSON(t *testing.T) {
@@ -253,7 +641,9 @@ func TestParseJSON(t *testing.T) {
 	go block.Serve()
 	testJsonGood := "{\"foo\":\"bar\", \"weight\":2.3, \"someArray\":[1,2,3]}"
 	out := make(chan Message)
+	errs := make(chan Message)
 	block.Connect(0, out)
+	block.Connect(1, errs)
 	in, _ := block.GetInput(0)
 	in.C <- testJsonGood
 	m := <-out
@@ -273,10 +663,14 @@ func TestParseJSON(t *testing.T) {
 	// now check it fails nicely
 	testJsonBad := "{\"foo\":bar, \"weight\":2.3, \"someArray\":[1,2,3]}"
 	in.C <- testJsonBad
-	m = <-out
-	_, ok = m.(error)
+	m = <-errs
+	e, ok := m.(*ErrorMessage)
 	if !ok {
 		t.Error("expected error")
+		return
+	}
+	if e.Pin != "out" || e.Inputs[0] != testJsonBad {
+		t.Error("error did not record its pin and inputs")
 	}
 }
 
@@ -328,3 +722,764 @@ func TestMerge(t *testing.T) {
 	expected = map[string]interface{}{"a": 3, "b": true, "c": map[string]interface{}{"foo": false, "bar": "car"}}
 	testMerge(inmsg4, inmsg6, expected)
 }
+
+func TestTypeCheck(t *testing.T) {
+	log.Println("testing type check")
+	add := NewBlock(GetLibrary()["+"])
+	errs := make(chan error, 1)
+	go func() {
+		for m := range add.Monitor {
+			if m.Type == BI_ERROR {
+				errs <- m.Data.(error)
+			}
+		}
+	}()
+	go add.Serve()
+	add.SetID(7)
+	add.SetTypeCheck(true)
+	out := make(chan Message)
+	add.Connect(0, out)
+	errOut := make(chan Message)
+	add.Connect(1, errOut)
+
+	if err := add.SetInput(1, &InputValue{"two"}); err == nil {
+		t.Error("set a string value on a number input")
+	}
+
+	// rejected inputs are emitted on the error output, and the inputs
+	// received before them are kept
+	x, _ := add.GetInput(0)
+	y, _ := add.GetInput(1)
+	x.C <- "one"
+	err, ok := (<-errs).(*TypeError)
+	if !ok {
+		t.Fatal("expected a TypeError")
+	}
+	if err.Block != 7 || err.Route != 0 || err.Pin != "x" || err.Expected != NUMBER || err.Actual != STRING || err.Output {
+		t.Error("unexpected TypeError", err)
+	}
+	e, ok := (<-errOut).(*ErrorMessage)
+	if !ok || e.Block != 7 || e.Pin != "x" || e.Inputs[0] != "one" {
+		t.Error("rejected input was not emitted on the error output", e)
+	}
+
+	x.C <- 1.0
+	y.C <- "two"
+	<-errs
+	e, ok = (<-errOut).(*ErrorMessage)
+	if !ok || e.Pin != "y" || e.Inputs[0] != 1.0 || e.Inputs[1] != "two" {
+		t.Error("rejected input was not emitted with the inputs before it", e)
+	}
+	y.C <- 2.0
+	if <-out != 3.0 {
+		t.Error("type checked block did not produce expected value")
+	}
+	add.Stop()
+}
+
+func TestReplay(t *testing.T) {
+	log.Println("testing replay")
+
+	out := make(chan Message)
+	add := NewBlock(GetLibrary()["+"])
+	go DummyMonitor(add.Monitor)
+	go add.Serve()
+	add.Connect(0, out)
+
+	if err := add.Replay([]Message{1.0}); err == nil {
+		t.Error("replayed inputs that don't match the block")
+	}
+
+	// a replay waits for the messages the block has already received
+	x, _ := add.GetInput(0)
+	y, _ := add.GetInput(1)
+	x.C <- 1.0
+	for len(x.C) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := add.Replay([]Message{10.0, 20.0}); err != nil {
+		t.Fatal(err)
+	}
+	y.C <- 2.0
+	if m := <-out; m != 3.0 {
+		t.Error("replay mixed with received messages, got", m)
+	}
+	if m := <-out; m != 30.0 {
+		t.Error("expected the replayed inputs to produce 30, got", m)
+	}
+	add.Stop()
+}
+
+func TestPause(t *testing.T) {
+	log.Println("testing pause")
+
+	out := make(chan Message)
+	b := NewBlock(GetLibrary()["identity"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+	b.Connect(0, out)
+
+	in, _ := b.GetInput(0)
+	b.Pause()
+	in.C <- "paused"
+
+	select {
+	case <-out:
+		t.Error("paused block emitted a message")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a paused block still accepts interrupts
+	err := b.SetInput(0, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	b.Resume()
+	if m := <-out; m != "paused" {
+		t.Error("resumed block emitted", m)
+	}
+	b.Stop()
+}
+
+func TestStats(t *testing.T) {
+	log.Println("testing stats")
+
+	out := make(chan Message)
+	b := NewBlock(GetLibrary()["+"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+	b.Connect(0, out)
+	b.Connect(1, out)
+
+	a, _ := b.GetInput(0)
+	c, _ := b.GetInput(1)
+	for i := 0; i < 3; i++ {
+		a.C <- 1.0
+		c.C <- 2.0
+		<-out
+	}
+	a.C <- "one"
+	c.C <- 2.0
+	<-out
+
+	// wait for the block to finish its last crank
+	b.Stop()
+
+	s := b.Stats()
+	if s.In[0] != 4 || s.In[1] != 4 {
+		t.Error("expected 4 messages in on each input, got", s.In)
+	}
+	if s.Out[0] != 3 || s.Out[1] != 1 {
+		t.Error("expected 3 messages out and 1 error, got", s.Out)
+	}
+	if s.Errors != 1 {
+		t.Error("expected 1 error, got", s.Errors)
+	}
+	// the kernel doesn't run on an input of the wrong type
+	if s.Kernel.Count != 3 || s.Kernel.Sum <= 0 {
+		t.Error("kernel histogram did not count every crank")
+	}
+}
+
+type testTracer struct {
+	hops chan Hop
+}
+
+func (t *testTracer) Start() (TraceID, bool) {
+	return 1, true
+}
+
+func (t *testTracer) Record(h Hop) {
+	t.hops <- h
+}
+
+func TestTrace(t *testing.T) {
+	log.Println("testing trace")
+
+	library := GetLibrary()
+	tracer := &testTracer{make(chan Hop, 2)}
+	stream := NewNSQ().(*NSQ)
+
+	receive := NewBlock(library["receive"])
+	identity := NewBlock(library["identity"])
+	for id, b := range []*Block{receive, identity} {
+		go DummyMonitor(b.Monitor)
+		go b.Serve()
+		b.SetID(id)
+		b.SetTracer(tracer)
+	}
+	receive.SetSource(stream)
+
+	in, _ := identity.GetInput(0)
+	receive.Connect(0, in.C)
+	out := make(chan Message)
+	identity.Connect(0, out)
+
+	stream.Out <- "traced"
+	m := <-out
+	if _, ok := m.(*traced); !ok {
+		t.Error("message lost its trace")
+	}
+	if Untrace(m) != "traced" {
+		t.Error("untraced message is", Untrace(m))
+	}
+
+	// each block records its hop once it has finished broadcasting, so the
+	// hops can arrive in either order
+	seen := make(map[int]bool)
+	for range []*Block{receive, identity} {
+		h := <-tracer.hops
+		if h.Trace != 1 || h.Block < 0 || h.Block > 1 || seen[h.Block] || len(h.Outputs) != 1 {
+			t.Error("unexpected hop", h)
+		}
+		seen[h.Block] = true
+	}
+	receive.Stop()
+	identity.Stop()
+}
+
+func TestTap(t *testing.T) {
+	log.Println("testing tap")
+
+	b := NewBlock(GetLibrary()["identity"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+
+	out := make(chan Message)
+	b.Connect(0, out)
+	tap := make(chan Message, 1)
+	if b.Tap(0, make(chan Message), tap) == nil {
+		t.Error("tapped a connection that does not exist")
+	}
+	err := b.Tap(0, out, tap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, _ := b.GetInput(0)
+	for _, m := range []string{"first", "second"} {
+		in.C <- m
+		if <-out != m {
+			t.Error("tap changed the delivered message")
+		}
+	}
+
+	// an interrupt waits for the block to finish its crank
+	b.SetID(0)
+
+	// the second message is dropped, since nothing read the first
+	if m := <-tap; m != "first" {
+		t.Error("tap received", m)
+	}
+	select {
+	case m := <-tap:
+		t.Error("full tap received", m)
+	default:
+	}
+
+	b.Tap(0, out, nil)
+	in.C <- "third"
+	<-out
+	b.SetID(0)
+	select {
+	case m := <-tap:
+		t.Error("removed tap received", m)
+	default:
+	}
+	b.Stop()
+}
+
+func TestBuffer(t *testing.T) {
+	log.Println("testing buffer")
+
+	if _, err := NewBuffer(make(Connection), 0, OVERFLOW_BLOCK); err == nil {
+		t.Error("created an empty buffer")
+	}
+
+	expected := map[OverflowPolicy][]Message{
+		OVERFLOW_DROP_OLDEST: []Message{2, 3},
+		OVERFLOW_DROP_NEWEST: []Message{1, 2},
+	}
+	for policy, messages := range expected {
+		out := make(Connection)
+		b, _ := NewBuffer(out, 2, policy)
+		go b.Serve()
+		for i := 1; i <= 3; i++ {
+			b.In <- i
+		}
+		for _, e := range messages {
+			if m := <-out; m != e {
+				t.Error("buffer delivered", m, "expected", e)
+			}
+		}
+		if b.Dropped() != 1 {
+			t.Error("buffer dropped", b.Dropped(), "messages")
+		}
+		b.Stop()
+	}
+
+	out := make(Connection)
+	b, _ := NewBuffer(out, 1, OVERFLOW_BLOCK)
+	go b.Serve()
+	b.In <- 1
+	select {
+	case b.In <- 2:
+		t.Error("full buffer accepted a message")
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.Resize(2, OVERFLOW_BLOCK)
+	b.In <- 2
+	// the buffer handles control functions in order with its messages
+	b.Resize(2, OVERFLOW_BLOCK)
+	if b.Len() != 2 {
+		t.Error("buffer holds", b.Len(), "messages")
+	}
+	b.Flush()
+	if b.Len() != 0 {
+		t.Error("flushed buffer holds", b.Len(), "messages")
+	}
+	b.In <- 3
+	if m := <-out; m != 3 {
+		t.Error("flushed buffer delivered", m)
+	}
+	b.Stop()
+
+	d, _ := json.Marshal(OVERFLOW_DROP_OLDEST)
+	var p OverflowPolicy
+	if err := json.Unmarshal(d, &p); err != nil || p != OVERFLOW_DROP_OLDEST {
+		t.Error("could not round trip overflow policy", string(d))
+	}
+}
+
+func TestSync(t *testing.T) {
+	log.Println("testing sync modes")
+
+	b := NewBlock(GetLibrary()["+"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+
+	if b.SetSync(SYNC_WINDOW, 0) == nil {
+		t.Error("set a window sync mode without a window")
+	}
+
+	out := make(chan Message)
+	errs := make(chan Message)
+	b.Connect(0, out)
+	b.Connect(1, errs)
+	a, _ := b.GetInput(0)
+	c, _ := b.GetInput(1)
+
+	// the block doesn't run until both inputs have had a message, then
+	// runs on every message
+	b.SetSync(SYNC_ANY, 0)
+	a.C <- 1.0
+	c.C <- 2.0
+	for _, e := range []float64{3, 7, 6} {
+		if m := <-out; m != e {
+			t.Error("any sync mode emitted", m, "expected", e)
+		}
+		switch e {
+		case 3:
+			a.C <- 5.0
+		case 7:
+			c.C <- 1.0
+		}
+	}
+
+	// an input that misses the window is nil
+	b.SetSync(SYNC_WINDOW, 10*time.Millisecond)
+	a.C <- 1.0
+	if m, ok := (<-errs).(*ErrorMessage); !ok || m.Inputs[1] != nil {
+		t.Error("window sync mode did not run with a partial input", m)
+	}
+	a.C <- 1.0
+	c.C <- 2.0
+	if m := <-out; m != 3.0 {
+		t.Error("window sync mode emitted", m)
+	}
+	b.Stop()
+
+	// a message that preempted the last crank's kernel is used instead of
+	// the latest message on its input
+	b = NewBlock(GetLibrary()["+"])
+	go DummyMonitor(b.Monitor)
+	b.inputs.latest[0] = 1.0
+	b.inputs.latest[1] = 2.0
+	b.state.inputValues[0] = 5.0
+	if f := b.receiveAny(); f != nil || b.state.inputValues[0] != 5.0 || b.state.inputValues[1] != 2.0 {
+		t.Error("any sync mode received", b.state.inputValues)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	log.Println("testing windows")
+
+	library := GetLibrary()
+
+	// run feeds messages to a window block's kernel, returning what it
+	// emits after each message
+	run := func(name string, param Message, aggregate string, messages ...Message) []Message {
+		internal := make(MessageMap)
+		emitted := []Message{}
+		for _, m := range messages {
+			out := make(MessageMap)
+			library[name].Kernel(MessageMap{0: m, 1: param, 2: aggregate}, out, internal, nil, nil)
+			emitted = append(emitted, out[0])
+		}
+		return emitted
+	}
+
+	tests := []struct {
+		name      string
+		param     Message
+		aggregate string
+		in        []Message
+		expected  []Message
+	}{
+		{"countWindow", 2.0, "sum", []Message{1.0, 2.0, 3.0, 4.0}, []Message{nil, 3.0, nil, 7.0}},
+		{"countWindow", 3.0, "distinct", []Message{"a", "b", "a"}, []Message{nil, nil, 2.0}},
+		{"slidingCountWindow", 2.0, "mean", []Message{1.0, 3.0, 5.0}, []Message{1.0, 2.0, 4.0}},
+		{"slidingCountWindow", 3.0, "max", []Message{1.0, 5.0, 2.0, 0.0}, []Message{1.0, 5.0, 5.0, 5.0}},
+		{"slidingCountWindow", 4.0, "p50", []Message{4.0, 1.0, 3.0, 2.0}, []Message{4.0, 1.0, 3.0, 2.0}},
+		{"slidingCountWindow", 2.0, "min", []Message{2.0, 1.0, 3.0}, []Message{2.0, 1.0, 1.0}},
+		{"slidingTimeWindow", "1h", "count", []Message{"a", "b"}, []Message{1.0, 2.0}},
+	}
+
+	for _, test := range tests {
+		emitted := run(test.name, test.param, test.aggregate, test.in...)
+		if !reflect.DeepEqual(emitted, test.expected) {
+			t.Error(test.name, test.aggregate, "emitted", emitted, "expected", test.expected)
+		}
+	}
+
+	for _, bad := range []struct {
+		name      string
+		param     Message
+		aggregate string
+		in        Message
+	}{
+		{"countWindow", 0.0, "sum", 1.0},
+		{"countWindow", math.NaN(), "sum", 1.0},
+		{"slidingCountWindow", 1e300, "sum", 1.0},
+		{"slidingCountWindow", math.Inf(1), "sum", 1.0},
+		{"countWindow", 1.0, "median", 1.0},
+		{"countWindow", 1.0, "sum", "a"},
+		{"timeWindow", "soon", "sum", 1.0},
+		{"slidingCountWindow", 1.0, "p101", 1.0},
+	} {
+		emitted := run(bad.name, bad.param, bad.aggregate, bad.in)
+		if _, ok := emitted[0].(error); !ok {
+			t.Error(bad.name, "accepted", bad.param, bad.aggregate, bad.in)
+		}
+	}
+
+	// a time window is emitted when it ends, without waiting for another
+	// message
+	b := NewBlock(library["timeWindow"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+	b.SetInput(1, &InputValue{"50ms"})
+	b.SetInput(2, &InputValue{"sum"})
+	emitted := make(chan Message)
+	b.Connect(0, emitted)
+	in, _ := b.GetInput(0)
+	start := time.Now()
+	in.C <- 1.0
+	in.C <- 2.0
+	select {
+	case m := <-emitted:
+		if m != 3.0 {
+			t.Error("time window emitted", m)
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Error("time window emitted before it ended")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("time window was not emitted")
+	}
+	b.Stop()
+}
+
+func TestRateBlocks(t *testing.T) {
+	log.Println("testing throttle, debounce, sample and rateLimit")
+
+	library := GetLibrary()
+
+	// at most 2 messages a minute
+	internal := make(MessageMap)
+	emitted := 0
+	for n := 0; n < 5; n++ {
+		out := make(MessageMap)
+		library["throttle"].Kernel(MessageMap{0: n, 1: 2.0, 2: "1m"}, out, internal, nil, nil)
+		if _, ok := out[0]; ok {
+			emitted++
+		}
+	}
+	if emitted != 2 {
+		t.Error("throttle emitted", emitted, "messages")
+	}
+
+	start := func(name string) (*Block, chan Message, chan Message) {
+		b := NewBlock(library[name])
+		go DummyMonitor(b.Monitor)
+		go b.Serve()
+		out := make(chan Message)
+		b.Connect(0, out)
+		in, _ := b.GetInput(0)
+		return b, in.C, out
+	}
+
+	// only the last of a burst of messages is emitted
+	b, in, out := start("debounce")
+	b.SetInput(1, &InputValue{Data: "20ms"})
+	for _, m := range []string{"a", "b", "c"} {
+		in <- m
+	}
+	if m := <-out; m != "c" {
+		t.Error("debounce emitted", m)
+	}
+	select {
+	case m := <-out:
+		t.Error("debounce emitted", m, "twice")
+	case <-time.After(40 * time.Millisecond):
+	}
+	// a debounce can be stopped while it waits
+	in <- "d"
+	b.Stop()
+
+	b, in, out = start("sample")
+	b.SetInput(1, &InputValue{Data: "20ms"})
+	in <- "a"
+	in <- "b"
+	if m := <-out; m != "b" {
+		t.Error("sample emitted", m)
+	}
+	b.Stop()
+
+	b, in, out = start("rateLimit")
+	b.SetInput(1, &InputValue{Data: 50.0})
+	b.SetInput(2, &InputValue{Data: 1.0})
+	begin := time.Now()
+	for _, m := range []string{"a", "b", "c"} {
+		in <- m
+		if e := <-out; e != m {
+			t.Error("rateLimit emitted", e)
+		}
+	}
+	// the first message uses the burst, the other two wait 20ms each
+	if d := time.Since(begin); d < 35*time.Millisecond {
+		t.Error("rateLimit emitted 3 messages in", d)
+	}
+	b.Stop()
+}
+
+func TestTickerAndCron(t *testing.T) {
+	log.Println("testing ticker and cron")
+
+	at := func(s string) time.Time {
+		v, _ := time.Parse("2006-01-02 15:04", s)
+		return v
+	}
+	tests := []struct {
+		expr, after, next string
+	}{
+		{"*/15 * * * *", "2015-06-01 10:07", "2015-06-01 10:15"},
+		{"0 9-17 * * 1-5", "2015-06-05 17:30", "2015-06-08 09:00"},
+		{"30 0 1 * *", "2015-06-01 00:30", "2015-07-01 00:30"},
+		{"0 0 * * 7", "2015-06-01 00:00", "2015-06-07 00:00"},
+		{"0 0 13 * 5", "2015-06-01 00:00", "2015-06-05 00:00"},
+		{"@yearly", "2015-06-01 00:00", "2016-01-01 00:00"},
+		{"5/20 * * * *", "2015-06-01 10:26", "2015-06-01 10:45"},
+	}
+	for _, test := range tests {
+		s, err := parseCron(test.expr)
+		if err != nil {
+			t.Error(test.expr, err)
+			continue
+		}
+		next, err := s.next(at(test.after))
+		if err != nil || !next.Equal(at(test.next)) {
+			t.Error(test.expr, "after", test.after, "is", next, "expected", test.next)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Error("parsed", bad)
+		}
+	}
+	s, _ := parseCron("0 0 31 2 *")
+	if _, err := s.next(at("2015-01-01 00:00")); err == nil {
+		t.Error("found a 31st of February")
+	}
+
+	b := NewBlock(GetLibrary()["ticker"])
+	go DummyMonitor(b.Monitor)
+	go b.Serve()
+	out := make(chan Message)
+	errs := make(chan Message)
+	b.Connect(0, out)
+	b.Connect(1, errs)
+
+	b.SetInput(0, &InputValue{Data: "10ms"})
+	first := (<-out).(float64)
+	second := (<-out).(float64)
+	if second-first != 10 {
+		t.Error("ticker ticked", second-first, "ms apart")
+	}
+
+	// a bad interval is reported once, and the ticker waits for a new one
+	b.SetInput(0, &InputValue{Data: "often"})
+	// a tick can be on its way out when the interval is set
+	for reported := false; !reported; {
+		select {
+		case <-out:
+		case <-errs:
+			reported = true
+		}
+	}
+	select {
+	case m := <-errs:
+		t.Error("ticker reported", m, "twice")
+	case m := <-out:
+		t.Error("ticker ticked", m, "with a bad interval")
+	case <-time.After(30 * time.Millisecond):
+	}
+	b.SetInput(0, &InputValue{Data: "5ms"})
+	<-out
+	b.Stop()
+}
+
+func TestPaths(t *testing.T) {
+	log.Println("testing paths")
+
+	library := GetLibrary()
+	message := func() Message {
+		var m interface{}
+		json.Unmarshal([]byte(`{"a":{"b":[{"c":1},{"c":2},{"d":3}]},"x.y":true}`), &m)
+		return m
+	}
+	unmarshal := func(s string) Message {
+		var m interface{}
+		json.Unmarshal([]byte(s), &m)
+		return m
+	}
+
+	tests := []struct {
+		block    string
+		in       MessageMap
+		expected Message
+	}{
+		{"getPath", MessageMap{1: "a.b[1].c"}, 2.0},
+		{"getPath", MessageMap{1: "$.a.b[-1].d"}, 3.0},
+		{"getPath", MessageMap{1: `["x.y"]`}, true},
+		{"getPath", MessageMap{1: "a.b[*].c"}, []interface{}{1.0, 2.0}},
+		{"getPath", MessageMap{1: "a.b[9].c"}, nil},
+		{"getPath", MessageMap{1: ""}, message()},
+		{"getPath", MessageMap{1: "*"}, []interface{}{unmarshal(`{"b":[{"c":1},{"c":2},{"d":3}]}`), true}},
+		{"setPath", MessageMap{1: "a.b[0].c", 2: 5.0}, unmarshal(`{"a":{"b":[{"c":5},{"c":2},{"d":3}]},"x.y":true}`)},
+		{"setPath", MessageMap{1: "a.b[*].e", 2: 0.0}, unmarshal(`{"a":{"b":[{"c":1,"e":0},{"c":2,"e":0},{"d":3,"e":0}]},"x.y":true}`)},
+		{"setPath", MessageMap{1: "n.m[1]", 2: "v"}, unmarshal(`{"a":{"b":[{"c":1},{"c":2},{"d":3}]},"x.y":true,"n":{"m":[null,"v"]}}`)},
+		{"deletePath", MessageMap{1: "a.b[1]"}, unmarshal(`{"a":{"b":[{"c":1},{"d":3}]},"x.y":true}`)},
+		{"deletePath", MessageMap{1: "a.b[*].c"}, unmarshal(`{"a":{"b":[{},{},{"d":3}]},"x.y":true}`)},
+		{"deletePath", MessageMap{1: `['x.y']`}, unmarshal(`{"a":{"b":[{"c":1},{"c":2},{"d":3}]}}`)},
+	}
+
+	for _, test := range tests {
+		in := test.in
+		in[0] = message()
+		out := make(MessageMap)
+		library[test.block].Kernel(in, out, nil, nil, nil)
+		if !reflect.DeepEqual(out[0], test.expected) {
+			t.Error(test.block, test.in[1], "emitted", out[0], "expected", test.expected)
+		}
+		if !reflect.DeepEqual(in[0], message()) {
+			t.Error(test.block, test.in[1], "modified its input")
+		}
+	}
+
+	for _, bad := range []string{"a[", "a[x]", "a..b", `a["b]`, "a[0]b"} {
+		if _, err := parsePath(bad); err == nil {
+			t.Error("parsed", bad)
+		}
+	}
+
+	out := make(MessageMap)
+	library["setPath"].Kernel(MessageMap{0: message(), 1: "a.b.c", 2: 1.0}, out, nil, nil, nil)
+	if _, ok := out[0].(error); !ok {
+		t.Error("set a key of an array")
+	}
+	out = make(MessageMap)
+	library["setPath"].Kernel(MessageMap{0: message(), 1: "a.b[100000000]", 2: 1.0}, out, nil, nil, nil)
+	if _, ok := out[0].(error); !ok {
+		t.Error("padded an array to a huge index")
+	}
+}
+
+func TestExpr(t *testing.T) {
+	log.Println("testing expr")
+
+	library := GetLibrary()
+	var message interface{}
+	json.Unmarshal([]byte(`{"price":20,"qty":6,"name":"Widget","tags":["a","b"],"user":{"admin":true}}`), &message)
+
+	tests := []struct {
+		expression string
+		expected   Message
+	}{
+		{"price * qty", 120.0},
+		{"1 + 2 * 3 - 4 / 2", 5.0},
+		{"(1 + 2) * 3 % 4", 1.0},
+		{"-qty + 1", -5.0},
+		{"price * qty > 100 ? 'large' : 'small'", "large"},
+		{"qty < 5 ? 'few' : qty < 10 ? 'some' : 'many'", "some"},
+		{"user.admin && !(price >= 30) || false", true},
+		{"name == 'Widget' && tags[1] == \"b\"", true},
+		{"tags[-1]", "b"},
+		{"missing.field", nil},
+		{"missing == null", true},
+		{"'count: ' + qty", "count: 6"},
+		{"upper(name) + lower(name)", "WIDGETwidget"},
+		{"len(name) + len(tags)", 8.0},
+		{"contains(name, 'dg') && startsWith(name, 'W') && endsWith(name, 't')", true},
+		{"substr(name, 1, 3) + substr(name, 4)", "idet"},
+		{"join(split('a-b-c', '-'), '+')", "a+b+c"},
+		{"max(price, qty, 50) - min(3, qty)", 47.0},
+		{"number('2.5') * 2", 5.0},
+		{"$.price", 20.0},
+	}
+
+	for _, test := range tests {
+		out := make(MessageMap)
+		library["expr"].Kernel(MessageMap{0: message, 1: test.expression}, out, make(MessageMap), nil, nil)
+		if !reflect.DeepEqual(out[0], test.expected) {
+			t.Error(test.expression, "emitted", out[0], "expected", test.expected)
+		}
+	}
+
+	for _, bad := range []string{"1 +", "(1", "a ? b", "nope(1)", "len(1, 2)", "'open", "a #", "a.1"} {
+		out := make(MessageMap)
+		library["expr"].Kernel(MessageMap{0: message, 1: bad}, out, make(MessageMap), nil, nil)
+		if _, ok := out[0].(error); !ok {
+			t.Error("compiled", bad)
+		}
+	}
+
+	for _, bad := range []string{"name * 2", "price && true", "price / 0", "tags['x']", "qty ? 1 : 2"} {
+		out := make(MessageMap)
+		library["expr"].Kernel(MessageMap{0: message, 1: bad}, out, make(MessageMap), nil, nil)
+		if _, ok := out[0].(error); !ok {
+			t.Error("evaluated", bad, "to", out[0])
+		}
+	}
+
+	// the expression is only compiled once
+	internal := make(MessageMap)
+	out := make(MessageMap)
+	library["expr"].Kernel(MessageMap{0: message, 1: "qty + 1"}, out, internal, nil, nil)
+	compiled := internal[0]
+	library["expr"].Kernel(MessageMap{0: map[string]interface{}{"qty": 1.0}, 1: "qty + 1"}, out, internal, nil, nil)
+	if internal[0] != compiled || out[0] != 2.0 {
+		t.Error("recompiled the expression or emitted", out[0])
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// a Buffer sits on a connection between an output and an input, queueing the
+// messages that the input isn't ready for yet. When the queue is full, the
+// buffer's overflow policy decides whether the output waits, the oldest
+// queued message is dropped, or the new message is dropped.
+
+type OverflowPolicy uint8
+
+const (
+	OVERFLOW_BLOCK OverflowPolicy = iota
+	OVERFLOW_DROP_OLDEST
+	OVERFLOW_DROP_NEWEST
+)
+
+func (o OverflowPolicy) MarshalJSON() ([]byte, error) {
+	switch o {
+	case OVERFLOW_BLOCK:
+		return []byte(`"block"`), nil
+	case OVERFLOW_DROP_OLDEST:
+		return []byte(`"drop-oldest"`), nil
+	case OVERFLOW_DROP_NEWEST:
+		return []byte(`"drop-newest"`), nil
+	}
+	return nil, errors.New("unknown overflow policy")
+}
+
+func (o *OverflowPolicy) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "block", "":
+		*o = OVERFLOW_BLOCK
+	case "drop-oldest":
+		*o = OVERFLOW_DROP_OLDEST
+	case "drop-newest":
+		*o = OVERFLOW_DROP_NEWEST
+	default:
+		return errors.New("unknown overflow policy " + s)
+	}
+	return nil
+}
+
+type Buffer struct {
+	In      Connection // the connection that the output sends on
+	out     Connection
+	size    int
+	policy  OverflowPolicy
+	queue   []Message
+	dropped uint64
+	control chan func() bool
+	sync.Mutex
+}
+
+// NewBuffer returns a buffer that delivers to out and holds up to size
+// messages.
+func NewBuffer(out Connection, size int, policy OverflowPolicy) (*Buffer, error) {
+	if size < 1 {
+		return nil, errors.New("buffer size must be at least 1")
+	}
+	return &Buffer{
+		In:      make(Connection),
+		out:     out,
+		size:    size,
+		policy:  policy,
+		queue:   []Message{},
+		control: make(chan func() bool),
+	}, nil
+}
+
+func (b *Buffer) Serve() {
+	for {
+		var in, out Connection
+		var next Message
+
+		b.Lock()
+		if len(b.queue) > 0 {
+			out = b.out
+			next = b.queue[0]
+		}
+		if len(b.queue) < b.size || b.policy != OVERFLOW_BLOCK {
+			in = b.In
+		}
+		b.Unlock()
+
+		select {
+		case m := <-in:
+			b.Lock()
+			b.push(m)
+			b.Unlock()
+		case out <- next:
+			b.Lock()
+			b.queue = b.queue[1:]
+			b.Unlock()
+		case f := <-b.control:
+			if !f() {
+				return
+			}
+		}
+	}
+}
+
+// push adds a message to the queue, applying the overflow policy if the
+// queue is full.
+func (b *Buffer) push(m Message) {
+	if len(b.queue) >= b.size {
+		b.dropped++
+		if b.policy == OVERFLOW_DROP_NEWEST {
+			return
+		}
+		b.queue = b.queue[1:]
+	}
+	b.queue = append(b.queue, m)
+}
+
+func (b *Buffer) Stop() {
+	b.control <- func() bool {
+		return false
+	}
+}
+
+// Flush discards every queued message.
+func (b *Buffer) Flush() {
+	returnVal := make(chan struct{}, 1)
+	b.control <- func() bool {
+		b.Lock()
+		b.queue = []Message{}
+		b.Unlock()
+		returnVal <- struct{}{}
+		return true
+	}
+	<-returnVal
+}
+
+// Resize changes the size and overflow policy of the buffer. If the buffer
+// holds more messages than its new size, the newest messages are kept.
+func (b *Buffer) Resize(size int, policy OverflowPolicy) error {
+	if size < 1 {
+		return errors.New("buffer size must be at least 1")
+	}
+	returnVal := make(chan struct{}, 1)
+	b.control <- func() bool {
+		b.Lock()
+		b.size = size
+		b.policy = policy
+		if len(b.queue) > size {
+			b.dropped += uint64(len(b.queue) - size)
+			b.queue = b.queue[len(b.queue)-size:]
+		}
+		b.Unlock()
+		returnVal <- struct{}{}
+		return true
+	}
+	<-returnVal
+	return nil
+}
+
+// Len returns the number of queued messages.
+func (b *Buffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.queue)
+}
+
+// Dropped returns the number of messages the buffer has dropped.
+func (b *Buffer) Dropped() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.dropped
+}
@@ -86,15 +86,8 @@ func Get() Spec {
 		Inputs:  []Pin{Pin{"in", OBJECT}, Pin{"key", STRING}},
 		Outputs: []Pin{Pin{"out", ANY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			obj, ok := in[0].(map[string]interface{})
-			if !ok {
-				out[0] = NewError("inbound message must be an object")
-			}
-			key, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("key must be a string")
-				return nil
-			}
+			obj := in[0].(map[string]interface{})
+			key := in[1].(string)
 			out[0] = obj[key]
 			return nil
 		},
@@ -141,11 +134,7 @@ func Latch() Spec {
 		Outputs: []Pin{Pin{"true", ANY}, Pin{"false", ANY}},
 
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			controlSignal, ok := in[1].(bool)
-			if !ok {
-				out[0] = NewError("Latch ctrl requires bool")
-				return nil
-			}
+			controlSignal := in[1].(bool)
 			if controlSignal {
 				out[0] = in[0]
 			} else {
@@ -194,21 +183,13 @@ func Merge() Spec {
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			result := make(map[string]interface{})
 			var err error
-			in0, ok := in[0].(map[string]interface{})
-			if !ok {
-				out[0] = NewError("Merge needs map")
-				return nil
-			}
+			in0 := in[0].(map[string]interface{})
 			result, err = MergeMap(result, in0)
 			if err != nil {
 				out[0] = err
 				return nil
 			}
-			in1, ok := in[1].(map[string]interface{})
-			if !ok {
-				out[0] = NewError("Merge needs map")
-				return nil
-			}
+			in1 := in[1].(map[string]interface{})
 			result, err = MergeMap(result, in1)
 			if err != nil {
 				out[0] = err
@@ -227,16 +208,8 @@ func Addition() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x+y", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			a1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Addition requires floats")
-				return nil
-			}
-			a2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Addition requires floats")
-				return nil
-			}
+			a1 := in[0].(float64)
+			a2 := in[1].(float64)
 			out[0] = a1 + a2
 			return nil
 		},
@@ -250,16 +223,8 @@ func Subtraction() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x-y", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			minuend, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Subtraction requires floats")
-				return nil
-			}
-			subtrahend, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Subtraction requires floats")
-				return nil
-			}
+			minuend := in[0].(float64)
+			subtrahend := in[1].(float64)
 			out[0] = minuend - subtrahend
 			return nil
 		},
@@ -273,16 +238,8 @@ func Multiplication() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x*y", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			m1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Multiplication requires floats")
-				return nil
-			}
-			m2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Multiplication requires floats")
-				return nil
-			}
+			m1 := in[0].(float64)
+			m2 := in[1].(float64)
 			out[0] = m1 * m2
 			return nil
 		},
@@ -296,16 +253,8 @@ func Division() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x/y", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			d1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Division requires floats")
-				return nil
-			}
-			d2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Division requires floats")
-				return nil
-			}
+			d1 := in[0].(float64)
+			d2 := in[1].(float64)
 			out[0] = d1 / d2
 			return nil
 		},
@@ -319,16 +268,8 @@ func Exponentiation() Spec {
 		Inputs:  []Pin{Pin{"base", NUMBER}, Pin{"exponent", NUMBER}},
 		Outputs: []Pin{Pin{"power", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			d1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Exponentiation requires floats")
-				return nil
-			}
-			d2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Exponentiation requires floats")
-				return nil
-			}
+			d1 := in[0].(float64)
+			d2 := in[1].(float64)
 			out[0] = math.Pow(d1, d2)
 			return nil
 		},
@@ -342,16 +283,8 @@ func Modulation() Spec {
 		Inputs:  []Pin{Pin{"dividend", NUMBER}, Pin{"divisor", NUMBER}},
 		Outputs: []Pin{Pin{"remainder", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			d1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("Modulation requires floats")
-				return nil
-			}
-			d2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("Modultion requires floats")
-				return nil
-			}
+			d1 := in[0].(float64)
+			d2 := in[1].(float64)
 			out[0] = math.Mod(d1, d2)
 			return nil
 		},
@@ -365,16 +298,8 @@ func GreaterThan() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x>y", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			d1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("GreaterThan requires float on x")
-				return nil
-			}
-			d2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("GreaterThan requires float on y")
-				return nil
-			}
+			d1 := in[0].(float64)
+			d2 := in[1].(float64)
 			out[0] = d1 > d2
 			return nil
 		},
@@ -388,16 +313,8 @@ func LessThan() Spec {
 		Inputs:  []Pin{Pin{"x", NUMBER}, Pin{"y", NUMBER}},
 		Outputs: []Pin{Pin{"x<y", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			d1, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("LessThan requires floats")
-				return nil
-			}
-			d2, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("LessThan requires floats")
-				return nil
-			}
+			d1 := in[0].(float64)
+			d2 := in[1].(float64)
 			out[0] = d1 < d2
 			return nil
 		},
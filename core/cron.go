@@ -0,0 +1,194 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a cron schedule is written as five fields: minute, hour, day of month,
+// month and day of week. each field is a *, a number, a range like 1-5, or a
+// list of these like 1,15,30, optionally followed by a step like */15. days of
+// the week run from 0, Sunday, to 6, and 7 is also Sunday. a schedule can
+// also be one of @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly.
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of the allowed values
+	anyDom, anyDow                bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	if d, ok := cronDescriptors[strings.TrimSpace(expr)]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New("cron expression must have 5 fields")
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDom = strings.HasPrefix(fields[2], "*")
+	s.anyDow = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+// parseCronField returns the set of values a field allows.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, errors.New("bad cron step in " + field)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			r := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(r[0])
+			if err != nil {
+				return 0, errors.New("bad cron field " + field)
+			}
+			hi = lo
+			if len(r) == 2 {
+				hi, err = strconv.Atoi(r[1])
+				if err != nil {
+					return 0, errors.New("bad cron field " + field)
+				}
+			} else if step > 1 {
+				// 5/15 means every 15 starting at 5
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.New("cron field " + field + " out of range")
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	// when both days are restricted, either can match
+	if !s.anyDom && !s.anyDow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time after t that matches the schedule.
+func (s *cronSchedule) next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a schedule that matches nothing, like the 31st of February, gives
+	// up after a few years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.New("cron expression never matches")
+}
+
+// Cron emits a timestamp at the times matched by a cron expression
+func Cron() Spec {
+	return Spec{
+		Name:    "cron",
+		Inputs:  []Pin{Pin{"expression", STRING}},
+		Outputs: []Pin{Pin{"timestamp", NUMBER}},
+		Preempt: true,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			expr, _ := in[0].(string)
+			if internal[1] != expr {
+				internal[1] = expr
+				delete(internal, 0)
+				schedule, err := parseCron(expr)
+				if err != nil {
+					out[0] = err
+					return nil
+				}
+				internal[0] = schedule
+			}
+
+			// a block with a fixed expression runs continuously, so
+			// after reporting a bad expression it waits for a new one
+			schedule, ok := internal[0].(*cronSchedule)
+			if !ok {
+				return <-i
+			}
+
+			next, err := schedule.next(time.Now())
+			if err != nil {
+				delete(internal, 0)
+				out[0] = err
+				return nil
+			}
+
+			timer := time.NewTimer(next.Sub(time.Now()))
+			select {
+			case <-timer.C:
+				out[0] = float64(next.UnixNano() / 1000000)
+				return nil
+			case f := <-i:
+				timer.Stop()
+				return f
+			}
+		},
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import "time"
+
+// ErrorRoute is the index a kernel writes to in its output MessageMap in order
+// to emit an error on the block's error output.
+const ErrorRoute RouteIndex = -1
+
+// ErrorPin is the implicit output that every block emits its errors on. It is
+// always the block's last output.
+var ErrorPin = Pin{"error", ERROR}
+
+// An ErrorMessage is emitted on a block's error output. Alongside the error it
+// records where the error was produced and the messages that caused it.
+type ErrorMessage struct {
+	Block  int       `json:"block"`
+	Pin    string    `json:"pin"`
+	Text   string    `json:"error"`
+	Inputs []Message `json:"inputs"`
+	Time   time.Time `json:"time"`
+}
+
+func (e *ErrorMessage) Error() string {
+	return e.Text
+}
+
+// errorText returns the text of an error message written by a kernel.
+func errorText(m Message) string {
+	if err, ok := m.(error); ok {
+		return err.Error()
+	}
+	if s, ok := m.(string); ok {
+		return s
+	}
+	return "unknown error"
+}
@@ -0,0 +1,765 @@
+package core
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the expr block evaluates an expression against its inbound message. names in
+// the expression are the fields of the message, and $ is the whole message.
+// fields can be followed by .name and [index], as in a.b[0]. expressions
+// support numbers, strings in single or double quotes, true, false and null;
+// the operators + - * / % == != < <= > >= && || ! and the ternary a ? b : c;
+// and the functions in exprFuncs. + joins strings when either side is a
+// string.
+
+type exprNode interface {
+	eval(m Message) (interface{}, error)
+}
+
+type exprLiteral struct {
+	v interface{}
+}
+
+type exprField struct {
+	name string
+}
+
+type exprMember struct {
+	x    exprNode
+	name string
+}
+
+type exprIndex struct {
+	x, index exprNode
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+type exprBinary struct {
+	op   string
+	l, r exprNode
+}
+
+type exprTernary struct {
+	cond, a, b exprNode
+}
+
+type exprCall struct {
+	f    exprFunc
+	args []exprNode
+}
+
+type exprFunc struct {
+	name     string
+	min, max int // the number of arguments. a max of -1 is any number.
+	f        func(args []interface{}) (interface{}, error)
+}
+
+// tokens
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokName
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	v    interface{}
+	pos  int
+}
+
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", "[", "]", ".", ",", "?", ":", "+", "-", "*", "/", "%", "!", "<", ">", "$"}
+
+func exprError(pos int, s string) error {
+	return NewError("expr: " + s + " at " + strconv.Itoa(pos))
+}
+
+func lexExpr(s string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	i := 0
+outer:
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				(s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, exprError(i, "bad number "+s[i:j])
+			}
+			tokens = append(tokens, exprToken{tokNumber, s[i:j], f, i})
+			i = j
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, exprError(i, "unclosed string")
+				}
+				if rune(s[j]) == r {
+					break
+				}
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					switch s[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(s[j])
+					}
+				} else {
+					b.WriteByte(s[j])
+				}
+				j++
+			}
+			tokens = append(tokens, exprToken{tokString, s[i : j+1], b.String(), i})
+			i = j + 1
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, exprToken{tokName, s[i:j], nil, i})
+			i = j
+		default:
+			for _, op := range exprOps {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, exprToken{tokOp, op, nil, i})
+					i += len(op)
+					continue outer
+				}
+			}
+			return nil, exprError(i, "unexpected "+string(r))
+		}
+	}
+	return append(tokens, exprToken{tokEOF, "end of expression", nil, len(s)}), nil
+}
+
+// parsing
+
+type exprParser struct {
+	tokens []exprToken
+	i      int
+}
+
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// compileExpr parses an expression.
+func compileExpr(s string) (exprNode, error) {
+	tokens, err := lexExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, exprError(t.pos, "unexpected "+t.text)
+	}
+	return n, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *exprParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOp(op) {
+		t := p.peek()
+		return exprError(t.pos, "expected "+op+" but found "+t.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	cond, err := p.binary(1)
+	if err != nil || !p.isOp("?") {
+		return cond, err
+	}
+	p.next()
+	a, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &exprTernary{cond, a, b}, nil
+}
+
+func (p *exprParser) binary(min int) (exprNode, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := exprPrecedence[t.text]
+		if t.kind != tokOp || !ok || prec < min {
+			return l, nil
+		}
+		p.next()
+		r, err := p.binary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &exprBinary{t.text, l, r}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.isOp("-") || p.isOp("!") {
+		op := p.next().text
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op, x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokName {
+				return nil, exprError(t.pos, "expected a name but found "+t.text)
+			}
+			x = &exprMember{x, t.text}
+		case p.isOp("["):
+			p.next()
+			index, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &exprIndex{x, index}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return &exprLiteral{t.v}, nil
+	case tokName:
+		switch t.text {
+		case "true":
+			return &exprLiteral{true}, nil
+		case "false":
+			return &exprLiteral{false}, nil
+		case "null":
+			return &exprLiteral{nil}, nil
+		}
+		if !p.isOp("(") {
+			return &exprField{t.text}, nil
+		}
+		return p.call(t)
+	case tokOp:
+		switch t.text {
+		case "$":
+			return &exprField{"$"}, nil
+		case "(":
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, exprError(t.pos, "unexpected "+t.text)
+}
+
+func (p *exprParser) call(name exprToken) (exprNode, error) {
+	f, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, exprError(name.pos, "unknown function "+name.text)
+	}
+	p.next()
+	args := []exprNode{}
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) < f.min || (f.max >= 0 && len(args) > f.max) {
+		return nil, exprError(name.pos, "wrong number of arguments to "+name.text)
+	}
+	return &exprCall{f, args}, nil
+}
+
+// evaluation
+
+func exprType(v interface{}) string {
+	return TypeOf(v).String()
+}
+
+func (n *exprLiteral) eval(m Message) (interface{}, error) {
+	return n.v, nil
+}
+
+func (n *exprField) eval(m Message) (interface{}, error) {
+	if n.name == "$" {
+		return m, nil
+	}
+	// like get, a field of null is null
+	if m == nil {
+		return nil, nil
+	}
+	obj, ok := m.(map[string]interface{})
+	if !ok {
+		return nil, NewError("expr: cannot get field " + n.name + " of " + exprType(m))
+	}
+	return obj[n.name], nil
+}
+
+func (n *exprMember) eval(m Message) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	return (&exprField{n.name}).eval(x)
+}
+
+func (n *exprIndex) eval(m Message) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	switch t := x.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if k, ok := index.(string); ok {
+			return t[k], nil
+		}
+	case []interface{}:
+		if f, ok := index.(float64); ok && f == math.Floor(f) {
+			if i, ok := arrayIndex(t, int(f)); ok {
+				return t[i], nil
+			}
+			return nil, nil
+		}
+	case string:
+		if f, ok := index.(float64); ok && f == math.Floor(f) {
+			r := []rune(t)
+			if i := int(f); i >= 0 && i < len(r) {
+				return string(r[i]), nil
+			}
+			return nil, nil
+		}
+	}
+	return nil, NewError("expr: cannot index " + exprType(x) + " with " + exprType(index))
+}
+
+func (n *exprUnary) eval(m Message) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	switch t := x.(type) {
+	case float64:
+		if n.op == "-" {
+			return -t, nil
+		}
+	case bool:
+		if n.op == "!" {
+			return !t, nil
+		}
+	}
+	return nil, NewError("expr: cannot apply " + n.op + " to " + exprType(x))
+}
+
+func (n *exprBinary) eval(m Message) (interface{}, error) {
+	l, err := n.l.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate their right side if they need to
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, NewError("expr: " + n.op + " requires booleans, not " + exprType(l))
+		}
+		if lb == (n.op == "||") {
+			return lb, nil
+		}
+		r, err := n.r.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, NewError("expr: " + n.op + " requires booleans, not " + exprType(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.r.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	}
+
+	_, ls := l.(string)
+	_, rs := r.(string)
+	if n.op == "+" && (ls || rs) {
+		return exprString(l) + exprString(r), nil
+	}
+	if ls && rs {
+		a, b := l.(string), r.(string)
+		switch n.op {
+		case "<":
+			return a < b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		case ">=":
+			return a >= b, nil
+		}
+	}
+
+	a, aok := l.(float64)
+	b, bok := r.(float64)
+	if !aok || !bok {
+		return nil, NewError("expr: cannot apply " + n.op + " to " + exprType(l) + " and " + exprType(r))
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, NewError("expr: division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, NewError("expr: division by zero")
+		}
+		return math.Mod(a, b), nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	}
+	return nil, NewError("expr: unknown operator " + n.op)
+}
+
+func (n *exprTernary) eval(m Message) (interface{}, error) {
+	cond, err := n.cond.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := cond.(bool)
+	if !ok {
+		return nil, NewError("expr: ? requires a boolean, not " + exprType(cond))
+	}
+	if c {
+		return n.a.eval(m)
+	}
+	return n.b.eval(m)
+}
+
+func (n *exprCall) eval(m Message) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.f.f(args)
+	if err != nil {
+		return nil, NewError("expr: " + n.f.name + ": " + err.Error())
+	}
+	return v, nil
+}
+
+// exprString formats a message as a string.
+func exprString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// functions
+
+func exprStrings(args []interface{}) ([]string, error) {
+	s := make([]string, len(args))
+	for i, a := range args {
+		v, ok := a.(string)
+		if !ok {
+			return nil, NewError("requires strings, not " + exprType(a))
+		}
+		s[i] = v
+	}
+	return s, nil
+}
+
+func exprNumbers(args []interface{}) ([]float64, error) {
+	f := make([]float64, len(args))
+	for i, a := range args {
+		v, ok := a.(float64)
+		if !ok {
+			return nil, NewError("requires numbers, not " + exprType(a))
+		}
+		f[i] = v
+	}
+	return f, nil
+}
+
+// exprStringFunc makes a function of strings.
+func exprStringFunc(name string, n int, f func(s []string) interface{}) exprFunc {
+	return exprFunc{name, n, n, func(args []interface{}) (interface{}, error) {
+		s, err := exprStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}}
+}
+
+// exprMathFunc makes a function of one number.
+func exprMathFunc(name string, f func(float64) float64) exprFunc {
+	return exprFunc{name, 1, 1, func(args []interface{}) (interface{}, error) {
+		x, err := exprNumbers(args)
+		if err != nil {
+			return nil, err
+		}
+		return f(x[0]), nil
+	}}
+}
+
+var exprFuncs map[string]exprFunc
+
+func init() {
+	funcs := []exprFunc{
+		exprStringFunc("upper", 1, func(s []string) interface{} { return strings.ToUpper(s[0]) }),
+		exprStringFunc("lower", 1, func(s []string) interface{} { return strings.ToLower(s[0]) }),
+		exprStringFunc("trim", 1, func(s []string) interface{} { return strings.TrimSpace(s[0]) }),
+		exprStringFunc("contains", 2, func(s []string) interface{} { return strings.Contains(s[0], s[1]) }),
+		exprStringFunc("startsWith", 2, func(s []string) interface{} { return strings.HasPrefix(s[0], s[1]) }),
+		exprStringFunc("endsWith", 2, func(s []string) interface{} { return strings.HasSuffix(s[0], s[1]) }),
+		exprStringFunc("replace", 3, func(s []string) interface{} { return strings.Replace(s[0], s[1], s[2], -1) }),
+		exprStringFunc("split", 2, func(s []string) interface{} {
+			parts := []interface{}{}
+			for _, p := range strings.Split(s[0], s[1]) {
+				parts = append(parts, p)
+			}
+			return parts
+		}),
+		exprMathFunc("abs", math.Abs),
+		exprMathFunc("floor", math.Floor),
+		exprMathFunc("ceil", math.Ceil),
+		exprMathFunc("sqrt", math.Sqrt),
+		exprMathFunc("round", func(x float64) float64 { return math.Floor(x + .5) }),
+		{"len", 1, 1, func(args []interface{}) (interface{}, error) {
+			switch t := args[0].(type) {
+			case string:
+				return float64(utf8.RuneCountInString(t)), nil
+			case []interface{}:
+				return float64(len(t)), nil
+			case map[string]interface{}:
+				return float64(len(t)), nil
+			}
+			return nil, NewError("requires a string, array or object, not " + exprType(args[0]))
+		}},
+		{"substr", 2, 3, func(args []interface{}) (interface{}, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, NewError("requires a string, not " + exprType(args[0]))
+			}
+			r := []rune(s)
+			bounds, err := exprNumbers(append(args[1:], float64(len(r)))[:2])
+			if err != nil {
+				return nil, err
+			}
+			start, end := int(bounds[0]), int(bounds[1])
+			if start < 0 || end > len(r) || start > end {
+				return nil, NewError("out of range")
+			}
+			return string(r[start:end]), nil
+		}},
+		{"join", 2, 2, func(args []interface{}) (interface{}, error) {
+			arr, ok := args[0].([]interface{})
+			sep, sok := args[1].(string)
+			if !ok || !sok {
+				return nil, NewError("requires an array and a string")
+			}
+			s := make([]string, len(arr))
+			for i, v := range arr {
+				s[i] = exprString(v)
+			}
+			return strings.Join(s, sep), nil
+		}},
+		{"string", 1, 1, func(args []interface{}) (interface{}, error) {
+			return exprString(args[0]), nil
+		}},
+		{"number", 1, 1, func(args []interface{}) (interface{}, error) {
+			switch t := args[0].(type) {
+			case float64:
+				return t, nil
+			case string:
+				return strconv.ParseFloat(strings.TrimSpace(t), 64)
+			case bool:
+				if t {
+					return 1.0, nil
+				}
+				return 0.0, nil
+			}
+			return nil, NewError("cannot convert " + exprType(args[0]) + " to a number")
+		}},
+		{"min", 1, -1, func(args []interface{}) (interface{}, error) {
+			x, err := exprNumbers(args)
+			if err != nil {
+				return nil, err
+			}
+			min := x[0]
+			for _, v := range x {
+				min = math.Min(min, v)
+			}
+			return min, nil
+		}},
+		{"max", 1, -1, func(args []interface{}) (interface{}, error) {
+			x, err := exprNumbers(args)
+			if err != nil {
+				return nil, err
+			}
+			max := x[0]
+			for _, v := range x {
+				max = math.Max(max, v)
+			}
+			return max, nil
+		}},
+	}
+
+	exprFuncs = make(map[string]exprFunc)
+	for _, f := range funcs {
+		exprFuncs[f.name] = f
+	}
+}
+
+// Expr evaluates an expression against the inbound message
+func Expr() Spec {
+	return Spec{
+		Name:    "expr",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"expression", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			e := in[1].(string)
+			// the expression is only compiled when it changes
+			if internal[1] != e {
+				n, err := compileExpr(e)
+				if err != nil {
+					delete(internal, 0)
+					delete(internal, 1)
+					out[0] = err
+					return nil
+				}
+				internal[0] = n
+				internal[1] = e
+			}
+			v, err := internal[0].(exprNode).eval(in[0])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			out[0] = Copy(v)
+			return nil
+		},
+	}
+}
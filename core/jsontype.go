@@ -1,6 +1,10 @@
 package core
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
 
 func (j *JSONType) UnmarshalJSON(data []byte) error {
 	jsonType := string(data)
@@ -21,6 +25,8 @@ func (j *JSONType) UnmarshalJSON(data []byte) error {
 		*j = JSONType(NULL)
 	case `"any"`:
 		*j = JSONType(ANY)
+	case `"error"`:
+		*j = JSONType(ERROR)
 	default:
 		return errors.New("Error unmarshalling JSONType")
 	}
@@ -45,6 +51,130 @@ func (j JSONType) MarshalJSON() ([]byte, error) {
 		return []byte(`"null"`), nil
 	case ANY:
 		return []byte(`"any"`), nil
+	case ERROR:
+		return []byte(`"error"`), nil
 	}
 	return nil, errors.New("Unknown pin type")
 }
+
+func (j JSONType) String() string {
+	switch j {
+	case NUMBER:
+		return "number"
+	case ARRAY:
+		return "array"
+	case OBJECT:
+		return "object"
+	case STRING:
+		return "string"
+	case BOOLEAN:
+		return "boolean"
+	case WRITER:
+		return "writer"
+	case NULL:
+		return "null"
+	case ANY:
+		return "any"
+	case ERROR:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Compatible reports whether messages emitted by an output of type from can be
+// received by an input of type to. A WRITER only matches another WRITER, ANY
+// matches every other type, and otherwise the types must be identical.
+func Compatible(from, to JSONType) bool {
+	if from == WRITER || to == WRITER {
+		return from == to
+	}
+	if from == ANY || to == ANY {
+		return true
+	}
+	return from == to
+}
+
+// Coercion returns the name of the library block that converts messages of
+// type from into messages of type to, if there is one.
+func Coercion(from, to JSONType) (string, bool) {
+	switch to {
+	case STRING:
+		switch from {
+		case NUMBER, BOOLEAN, ARRAY, OBJECT, NULL:
+			return "toString", true
+		}
+	case NUMBER:
+		switch from {
+		case STRING, BOOLEAN:
+			return "toNumber", true
+		}
+	case ARRAY, OBJECT:
+		if from == STRING {
+			return "parseJSON", true
+		}
+	}
+	return "", false
+}
+
+// TypeOf returns the JSONType of a message. Messages whose type cannot be
+// determined are reported as ANY.
+func TypeOf(m Message) JSONType {
+	switch m.(type) {
+	case nil:
+		return NULL
+	case float64, float32, int, int64, uint64:
+		return NUMBER
+	case string:
+		return STRING
+	case bool:
+		return BOOLEAN
+	case []interface{}:
+		return ARRAY
+	case map[string]interface{}:
+		return OBJECT
+	case error:
+		return ERROR
+	case io.Writer:
+		return WRITER
+	}
+	return ANY
+}
+
+// toFloat converts any of the number types TypeOf knows to a float64.
+func toFloat(m Message) float64 {
+	switch n := m.(type) {
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return m.(float64)
+}
+
+// Accepts reports whether m is a valid message for a pin of type j.
+func (j JSONType) Accepts(m Message) bool {
+	return Compatible(TypeOf(m), j)
+}
+
+// A TypeError describes a message that did not match the type of the pin it
+// was received on or broadcast from.
+type TypeError struct {
+	Block    int      `json:"block"` // the id of the block that rejected the message
+	Route    int      `json:"route"` // the index of the pin
+	Pin      string   `json:"pin"`
+	Output   bool     `json:"output"`
+	Expected JSONType `json:"expected"`
+	Actual   JSONType `json:"actual"`
+}
+
+func (e *TypeError) Error() string {
+	direction := "input"
+	if e.Output {
+		direction = "output"
+	}
+	return fmt.Sprintf("block %d %s %s expected %s, got %s", e.Block, direction, e.Pin, e.Expected, e.Actual)
+}
@@ -24,6 +24,10 @@ func GetLibrary() map[string]Spec {
 	b := []Spec{
 		// mechanisms
 		Delay(),
+		Throttle(),
+		Debounce(),
+		Sample(),
+		RateLimit(),
 		Set(),
 		Get(),
 		Keys(),
@@ -41,6 +45,8 @@ func GetLibrary() map[string]Spec {
 		Merge(),
 		Len(),
 		Timestamp(),
+		Ticker(),
+		Cron(),
 
 		// monads
 		Exp(),
@@ -87,6 +93,14 @@ func GetLibrary() map[string]Spec {
 		kvDump(),
 		kvDelete(),
 
+		// paths
+		GetPath(),
+		SetPath(),
+		DeletePath(),
+
+		// expressions
+		Expr(),
+
 		// parsers
 		ParseJSON(),
 
@@ -115,16 +129,29 @@ func GetLibrary() map[string]Spec {
 		pqLen(),
 		pqClear(),
 
+		// dead letter
+		deadLetter(),
+		deadLetterPop(),
+		deadLetterDump(),
+
 		// stateful
 		First(),
 
+		// windows
+		CountWindow(),
+		SlidingCountWindow(),
+		TimeWindow(),
+		SlidingTimeWindow(),
+
 		// network IO
 		GET(),
+		HTTPRequest(),
 
 		// IO
 		Write(),
 		Close(),
 		Flush(),
+		Respond(),
 
 		//assertions
 		IsBoolean(),
@@ -6,16 +6,8 @@ func And() Spec {
 		Inputs:  []Pin{Pin{"in", BOOLEAN}, Pin{"in", BOOLEAN}},
 		Outputs: []Pin{Pin{"out", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			x, ok := in[0].(bool)
-			if !ok {
-				out[0] = NewError("need boolean")
-				return nil
-			}
-			y, ok := in[1].(bool)
-			if !ok {
-				out[0] = NewError("need boolean")
-				return nil
-			}
+			x := in[0].(bool)
+			y := in[1].(bool)
 			out[0] = x && y
 			return nil
 		},
@@ -28,16 +20,8 @@ func Or() Spec {
 		Inputs:  []Pin{Pin{"in", BOOLEAN}, Pin{"in", BOOLEAN}},
 		Outputs: []Pin{Pin{"out", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			x, ok := in[0].(bool)
-			if !ok {
-				out[0] = NewError("need boolean")
-				return nil
-			}
-			y, ok := in[1].(bool)
-			if !ok {
-				out[0] = NewError("need boolean")
-				return nil
-			}
+			x := in[0].(bool)
+			y := in[1].(bool)
 			out[0] = x || y
 			return nil
 		},
@@ -50,11 +34,7 @@ func Not() Spec {
 		Inputs:  []Pin{Pin{"in", BOOLEAN}},
 		Outputs: []Pin{Pin{"out", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			x, ok := in[0].(bool)
-			if !ok {
-				out[0] = NewError("need boolean")
-				return nil
-			}
+			x := in[0].(bool)
 			out[0] = !x
 			return nil
 		},
@@ -9,11 +9,7 @@ func InArray() Spec {
 		Inputs:  []Pin{Pin{"element", ANY}, Pin{"array", ARRAY}},
 		Outputs: []Pin{Pin{"inArray", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			arr, ok := in[1].([]interface{})
-			if !ok {
-				out[0] = NewError("inArray requries array")
-				return nil
-			}
+			arr := in[1].([]interface{})
 			for _, x := range arr {
 				if x == in[0] {
 					out[0] = true
@@ -33,16 +29,8 @@ func HasField() Spec {
 		Inputs:  []Pin{Pin{"field", STRING}, Pin{"object", OBJECT}},
 		Outputs: []Pin{Pin{"hasField", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			obj, ok := in[1].(map[string]interface{})
-			if !ok {
-				out[0] = NewError("HasField requries map for object")
-				return nil
-			}
-			field, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("HasField requires string for field")
-				return nil
-			}
+			obj := in[1].(map[string]interface{})
+			field := in[0].(string)
 			_, out[0] = obj[field]
 			return nil
 		},
@@ -56,16 +44,8 @@ func InString() Spec {
 		Inputs:  []Pin{Pin{"substring", STRING}, Pin{"string", STRING}},
 		Outputs: []Pin{Pin{"inString", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			substring, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("HasField requires strings")
-				return nil
-			}
-			superstring, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("HasField requires strings")
-				return nil
-			}
+			substring := in[0].(string)
+			superstring := in[1].(string)
 			out[0] = strings.Contains(superstring, substring)
 			return nil
 		},
@@ -79,16 +59,8 @@ func HasPrefix() Spec {
 		Inputs:  []Pin{Pin{"substring", STRING}, Pin{"string", STRING}},
 		Outputs: []Pin{Pin{"inString", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			substring, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("HasPrefix requires strings")
-				return nil
-			}
-			superstring, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("HasPrefix requires strings")
-				return nil
-			}
+			substring := in[0].(string)
+			superstring := in[1].(string)
 			out[0] = strings.HasPrefix(superstring, substring)
 			return nil
 		},
@@ -102,16 +74,8 @@ func HasSuffix() Spec {
 		Inputs:  []Pin{Pin{"substring", STRING}, Pin{"string", STRING}},
 		Outputs: []Pin{Pin{"inString", BOOLEAN}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			substring, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("HasSuffix requires strings")
-				return nil
-			}
-			superstring, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("HasSuffix requires strings")
-				return nil
-			}
+			substring := in[0].(string)
+			superstring := in[1].(string)
 			out[0] = strings.HasSuffix(superstring, substring)
 			return nil
 		},
@@ -10,11 +10,7 @@ func Exp() Spec {
 		Inputs:  []Pin{Pin{"power", NUMBER}},
 		Outputs: []Pin{Pin{"product", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Exp(p)
 			return nil
 		},
@@ -27,11 +23,7 @@ func Floor() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"out", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Floor(p)
 			return nil
 		},
@@ -44,11 +36,7 @@ func Ceil() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"out", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Ceil(p)
 			return nil
 		},
@@ -61,11 +49,7 @@ func Log10() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"log10", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Log10(p)
 			return nil
 		},
@@ -77,11 +61,7 @@ func Ln() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"ln", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Log(p)
 			return nil
 		},
@@ -94,11 +74,7 @@ func Sqrt() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"squareRoot", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Sqrt(p)
 			return nil
 		},
@@ -111,11 +87,7 @@ func Sin() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"sin", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Sin(p)
 			return nil
 		},
@@ -128,11 +100,7 @@ func Cos() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"cos", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Cos(p)
 			return nil
 		},
@@ -145,11 +113,7 @@ func Tan() Spec {
 		Inputs:  []Pin{Pin{"in", NUMBER}},
 		Outputs: []Pin{Pin{"tan", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("need float")
-				return nil
-			}
+			p := in[0].(float64)
 			out[0] = math.Tan(p)
 			return nil
 		},
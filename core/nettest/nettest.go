@@ -0,0 +1,221 @@
+// Package nettest stands in for the network in tests of network blocks. A
+// Server answers requests with scripted responses and records what it
+// received, and Send drives a request through a handler that answers it
+// asynchronously, like a core.Server whose endpoint blocks write the
+// response.
+package nettest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a scripted response.
+type Response struct {
+	Status int // defaults to 200
+	Header map[string]string
+	Body   string
+	Delay  time.Duration // how long to wait before responding
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// Server is an httptest.Server that answers with scripted responses.
+type Server struct {
+	*httptest.Server
+	sync.Mutex
+	responses map[string][]Response
+	requests  []Request
+}
+
+// NewServer starts a Server. Requests for routes that haven't been scripted
+// are answered with a 404. Close the Server when the test is done.
+func NewServer() *Server {
+	s := &Server{
+		responses: make(map[string][]Response),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Script sets the responses for a route, which is a path like /a, or a method
+// and a path like POST /a. Responses are served in order, and the last one
+// is repeated once the rest have been served.
+func (s *Server) Script(route string, responses ...Response) {
+	s.Lock()
+	defer s.Unlock()
+	s.responses[route] = responses
+}
+
+// Requests returns the requests the server has received, in order.
+func (s *Server) Requests() []Request {
+	s.Lock()
+	defer s.Unlock()
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// next records a request and returns the response to it.
+func (s *Server) next(r Request) (Response, bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests = append(s.requests, r)
+	for _, route := range []string{r.Method + " " + r.Path, r.Path} {
+		responses, ok := s.responses[route]
+		if !ok || len(responses) == 0 {
+			continue
+		}
+		if len(responses) > 1 {
+			s.responses[route] = responses[1:]
+		}
+		return responses[0], true
+	}
+	return Response{}, false
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	resp, ok := s.next(Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header,
+		Body:   string(body),
+	})
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	for k, v := range resp.Header {
+		w.Header().Set(k, v)
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	w.WriteHeader(resp.Status)
+	w.Write([]byte(resp.Body))
+}
+
+// Exchange is a request sent to a handler by Send.
+type Exchange struct {
+	recorder *httptest.ResponseRecorder
+	done     chan struct{}
+}
+
+// Send serves a request with h in the background. An empty body sends no
+// body.
+func Send(h http.Handler, method, target, body string) *Exchange {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	e := &Exchange{
+		recorder: httptest.NewRecorder(),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		h.ServeHTTP(e.recorder, req)
+		close(e.done)
+	}()
+	return e
+}
+
+// Done is closed once the handler has finished with the request.
+func (e *Exchange) Done() <-chan struct{} {
+	return e.done
+}
+
+// Wait waits up to timeout for the handler to finish, and returns what it
+// wrote.
+func (e *Exchange) Wait(timeout time.Duration) (*httptest.ResponseRecorder, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+		return e.recorder, nil
+	case <-timer.C:
+		return nil, errors.New("handler did not finish within " + timeout.String())
+	}
+}
+
+// WriteCert writes a self-signed certificate for 127.0.0.1 and localhost, and
+// its key, to files in dir. It returns the paths of the files.
+func WriteCert(dir string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"nettest"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: &pem.Block{Type: "CERTIFICATE", Bytes: der},
+		keyFile:  &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		f, err := os.Create(file)
+		if err != nil {
+			return "", "", err
+		}
+		err = pem.Encode(f, block)
+		f.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return certFile, keyFile, nil
+}
@@ -1,10 +1,16 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -12,7 +18,7 @@ import (
 //
 //Pin 0: URL string
 //
-//Pin 1: header []string
+//Pin 1: header object
 func GET() Spec {
 	return Spec{
 		Name:    "GET",
@@ -20,18 +26,17 @@ func GET() Spec {
 		Outputs: []Pin{Pin{"response", STRING}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 
-			url, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("HTTPGET requires url to be a string")
-				return nil
-			}
+			url := in[0].(string)
 
 			// header should be provided as a map like {"Content-Type": "application/x-www-form-urlencoded"}
-			// TODO
-			header, ok := in[1].(map[string]string)
-			if !ok {
-				out[0] = NewError("HTTPGET requres headers to be a map")
-				return nil
+			header := make(map[string]string)
+			for key, v := range in[1].(map[string]interface{}) {
+				value, ok := httpValue(v)
+				if !ok {
+					out[0] = NewError("header " + key + " must be a string, number or boolean")
+					return nil
+				}
+				header[key] = value
 			}
 
 			// let's only make one client. We'll store it in the internal state
@@ -85,3 +90,263 @@ func GET() Spec {
 		},
 	}
 }
+
+// an httpCall is a request made by the httpRequest block, built from its
+// inputs.
+type httpCall struct {
+	method  string
+	url     string
+	header  http.Header
+	host    string
+	body    []byte
+	timeout time.Duration
+	retries int
+}
+
+// an httpResult is the response to an httpCall.
+type httpResult struct {
+	status int
+	header map[string]interface{}
+	body   Message
+	err    error
+}
+
+// httpValue formats a query or header value as a string.
+func httpValue(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64, bool:
+		b, _ := json.Marshal(t)
+		return string(b), true
+	}
+	return "", false
+}
+
+func newHTTPCall(in MessageMap) (*httpCall, error) {
+	c := &httpCall{header: make(http.Header)}
+
+	rawurl := in[0].(string)
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	method := in[1].(string)
+	c.method = strings.ToUpper(method)
+	if c.method == "" {
+		c.method = "GET"
+	}
+
+	// query values are added to any query already in the url. an array adds
+	// the key once for each of its values.
+	query := in[2].(map[string]interface{})
+	q := u.Query()
+	for k, v := range query {
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, value := range values {
+			s, ok := httpValue(value)
+			if !ok {
+				return nil, NewError("query " + k + " must be a string, number, boolean or array of them")
+			}
+			q.Add(k, s)
+		}
+	}
+	u.RawQuery = q.Encode()
+	c.url = u.String()
+
+	header := in[3].(map[string]interface{})
+	for k, v := range header {
+		s, ok := httpValue(v)
+		if !ok {
+			return nil, NewError("header " + k + " must be a string, number or boolean")
+		}
+		if http.CanonicalHeaderKey(k) == "Host" {
+			c.host = s
+		} else {
+			c.header.Set(k, s)
+		}
+	}
+
+	// a string body is sent as it is, anything else but null is sent as JSON
+	switch t := in[4].(type) {
+	case nil:
+	case string:
+		c.body = []byte(t)
+	default:
+		c.body, err = json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		if c.header.Get("Content-Type") == "" {
+			c.header.Set("Content-Type", "application/json")
+		}
+	}
+
+	timeout := in[5].(string)
+	if timeout != "" {
+		c.timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return nil, err
+		}
+		if c.timeout < 0 {
+			return nil, NewError("httpRequest timeout cannot be negative")
+		}
+	}
+
+	retries, ok := in[6].(float64)
+	if !ok || retries < 0 {
+		return nil, NewError("httpRequest requires retries to be a number that isn't negative")
+	}
+	c.retries = int(retries)
+
+	return c, nil
+}
+
+// do makes the request, returning early if the block is interrupted.
+func (c *httpCall) do(client *http.Client, i chan Interrupt) (*httpResult, Interrupt) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), c.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	var body io.Reader
+	if c.body != nil {
+		body = bytes.NewReader(c.body)
+	}
+	req, err := http.NewRequest(c.method, c.url, body)
+	if err != nil {
+		return &httpResult{err: err}, nil
+	}
+	req = req.WithContext(ctx)
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if c.host != "" {
+		req.Host = c.host
+	}
+
+	done := make(chan *httpResult, 1)
+	go func() {
+		done <- readHTTPResponse(client.Do(req))
+	}()
+
+	select {
+	case r := <-done:
+		return r, nil
+	case f := <-i:
+		cancel()
+		<-done
+		return nil, f
+	}
+}
+
+// readHTTPResponse reads a response's body, parsing it if it is JSON.
+func readHTTPResponse(resp *http.Response, err error) *httpResult {
+	if err != nil {
+		return &httpResult{err: err}
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &httpResult{err: err}
+	}
+
+	r := &httpResult{
+		status: resp.StatusCode,
+		header: make(map[string]interface{}),
+		body:   string(raw),
+	}
+	for k, v := range resp.Header {
+		r.header[k] = strings.Join(v, ", ")
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var body interface{}
+		if err := json.Unmarshal(raw, &body); err == nil {
+			r.body = body
+		}
+	}
+	return r
+}
+
+// HTTPRequest makes an HTTP request, emitting the response's status code,
+// headers and body. A JSON body is parsed, any other body is emitted as a
+// string. Requests that fail with a 5xx status are retried up to retries
+// times, waiting twice as long after each attempt, up to a minute.
+func HTTPRequest() Spec {
+	return Spec{
+		Name: "httpRequest",
+		Inputs: []Pin{
+			Pin{"url", STRING},
+			Pin{"method", STRING},
+			Pin{"query", OBJECT},
+			Pin{"headers", OBJECT},
+			Pin{"body", ANY},
+			Pin{"timeout", STRING},
+			Pin{"retries", NUMBER},
+		},
+		Outputs: []Pin{
+			Pin{"status", NUMBER},
+			Pin{"headers", OBJECT},
+			Pin{"body", ANY},
+		},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			c, err := newHTTPCall(in)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+
+			// the client is kept so that its connections are reused
+			client, ok := internal[0].(*http.Client)
+			if !ok {
+				client = &http.Client{}
+				internal[0] = client
+			}
+
+			backoff := httpBackoff
+			for attempt := 0; ; attempt++ {
+				r, f := c.do(client, i)
+				if f != nil {
+					return f
+				}
+				if r.err != nil {
+					out[0] = r.err
+					return nil
+				}
+				if r.status < 500 || attempt >= c.retries {
+					out[0] = float64(r.status)
+					out[1] = r.header
+					out[2] = r.body
+					return nil
+				}
+
+				timer := time.NewTimer(backoff)
+				select {
+				case <-timer.C:
+				case f := <-i:
+					timer.Stop()
+					return f
+				}
+				backoff *= 2
+				if backoff > httpMaxBackoff {
+					backoff = httpMaxBackoff
+				}
+			}
+		},
+	}
+}
+
+// httpBackoff is how long httpRequest waits before its first retry, and
+// httpMaxBackoff the longest it waits between retries.
+var (
+	httpBackoff    = 100 * time.Millisecond
+	httpMaxBackoff = time.Minute
+)
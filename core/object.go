@@ -7,10 +7,7 @@ func Keys() Spec {
 		Inputs:  []Pin{Pin{"in", OBJECT}},
 		Outputs: []Pin{Pin{"keys", ARRAY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			obj, ok := in[0].(map[string]interface{})
-			if !ok {
-				out[0] = NewError("Keys requires an object")
-			}
+			obj := in[0].(map[string]interface{})
 			keys := make([]interface{}, len(obj))
 			j := 0
 			for k, _ := range obj {
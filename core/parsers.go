@@ -8,11 +8,7 @@ func ParseJSON() Spec {
 		Inputs:  []Pin{Pin{"in", STRING}},
 		Outputs: []Pin{Pin{"out", ANY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			msgstring, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("ParseJSON needs string")
-				return nil
-			}
+			msgstring := in[0].(string)
 			msgbytes := []byte(msgstring)
 			var msg interface{}
 			err := json.Unmarshal(msgbytes, &msg)
@@ -0,0 +1,333 @@
+package core
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a path picks out values inside a message, like a.b[3].c. keys follow dots
+// and indices go in brackets. a key that isn't a plain name can be quoted in
+// brackets, like a["b.c"]. negative indices count back from the end of an
+// array. a * in place of a key or an index matches every value of an object or
+// array. a path can start with $, and the empty path is the whole message.
+
+// maxPathPadding is the most nulls setPath will pad an array with to set an
+// index past its end.
+const maxPathPadding = 1024
+
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func (s pathSegment) String() string {
+	switch {
+	case s.wildcard:
+		return "[*]"
+	case s.isIndex:
+		return "[" + strconv.Itoa(s.index) + "]"
+	}
+	return "." + s.key
+}
+
+func parsePath(p string) ([]pathSegment, error) {
+	p = strings.TrimPrefix(p, "$")
+	path := []pathSegment{}
+	for i := 0; i < len(p); {
+		switch {
+		case p[i] == '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, NewError("unclosed [ in path " + p)
+			}
+			inner := p[i+1 : i+end]
+			// a quoted key can contain a ], so look for the closing quote
+			if len(inner) > 0 && (inner[0] == '"' || inner[0] == '\'') {
+				q := strings.IndexByte(p[i+2:], inner[0])
+				if q < 0 || i+2+q+1 >= len(p) || p[i+2+q+1] != ']' {
+					return nil, NewError("unclosed quote in path " + p)
+				}
+				path = append(path, pathSegment{key: p[i+2 : i+2+q]})
+				i += 2 + q + 2
+				continue
+			}
+			if inner == "*" {
+				path = append(path, pathSegment{wildcard: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, NewError("bad index [" + inner + "] in path " + p)
+				}
+				path = append(path, pathSegment{index: index, isIndex: true})
+			}
+			i += end + 1
+		default:
+			if p[i] == '.' {
+				i++
+			} else if i > 0 {
+				return nil, NewError("bad path " + p)
+			}
+			end := strings.IndexAny(p[i:], ".[")
+			if end < 0 {
+				end = len(p) - i
+			}
+			key := p[i : i+end]
+			if key == "" {
+				return nil, NewError("empty key in path " + p)
+			}
+			if key == "*" {
+				path = append(path, pathSegment{wildcard: true})
+			} else {
+				path = append(path, pathSegment{key: key})
+			}
+			i += end
+		}
+	}
+	return path, nil
+}
+
+func hasWildcard(path []pathSegment) bool {
+	for _, s := range path {
+		if s.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// arrayIndex returns the position of an index in arr, counting negative
+// indices from the end.
+func arrayIndex(arr []interface{}, index int) (int, bool) {
+	if index < 0 {
+		index += len(arr)
+	}
+	return index, index >= 0 && index < len(arr)
+}
+
+// getPath returns every value in v that matches the path. A wildcard matches
+// the values of an object in the order of their keys.
+func getPath(v interface{}, path []pathSegment) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	s := path[0]
+	matches := []interface{}{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				matches = append(matches, getPath(t[k], path[1:])...)
+			}
+		} else if c, ok := t[s.key]; ok && !s.isIndex {
+			matches = getPath(c, path[1:])
+		}
+	case []interface{}:
+		if s.wildcard {
+			for _, c := range t {
+				matches = append(matches, getPath(c, path[1:])...)
+			}
+		} else if i, ok := arrayIndex(t, s.index); ok && s.isIndex {
+			matches = getPath(t[i], path[1:])
+		}
+	}
+	return matches
+}
+
+// setPath sets the values in v that match the path to value, creating the
+// objects and arrays that are missing along the way. It modifies v, and
+// returns the new v.
+func setPath(v interface{}, path []pathSegment, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return Copy(value), nil
+	}
+	s := path[0]
+	var err error
+	switch {
+	case s.wildcard:
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, c := range t {
+				if t[k], err = setPath(c, path[1:], value); err != nil {
+					return nil, err
+				}
+			}
+			return t, nil
+		case []interface{}:
+			for k, c := range t {
+				if t[k], err = setPath(c, path[1:], value); err != nil {
+					return nil, err
+				}
+			}
+			return t, nil
+		}
+		return nil, NewError("cannot match " + s.String() + " in " + TypeOf(v).String())
+	case s.isIndex:
+		arr, ok := v.([]interface{})
+		if v == nil {
+			arr, ok = []interface{}{}, true
+		}
+		if !ok {
+			return nil, NewError("cannot index " + TypeOf(v).String() + " with " + s.String())
+		}
+		i := s.index
+		if i < 0 {
+			i += len(arr)
+			if i < 0 {
+				return nil, NewError("index " + s.String() + " out of range")
+			}
+		}
+		// setting past the end of an array pads it with nulls
+		if i-len(arr) > maxPathPadding {
+			return nil, NewError("index " + s.String() + " is too far past the end of the array")
+		}
+		for len(arr) <= i {
+			arr = append(arr, nil)
+		}
+		if arr[i], err = setPath(arr[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if v == nil {
+		obj, ok = map[string]interface{}{}, true
+	}
+	if !ok {
+		return nil, NewError("cannot get key " + s.key + " of " + TypeOf(v).String())
+	}
+	if obj[s.key], err = setPath(obj[s.key], path[1:], value); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// deletePath removes the values in v that match the path. It modifies v, and
+// returns the new v.
+func deletePath(v interface{}, path []pathSegment) interface{} {
+	s := path[0]
+	last := len(path) == 1
+	switch t := v.(type) {
+	case map[string]interface{}:
+		switch {
+		case s.wildcard && last:
+			return map[string]interface{}{}
+		case s.wildcard:
+			for k, c := range t {
+				t[k] = deletePath(c, path[1:])
+			}
+		case s.isIndex:
+		case last:
+			delete(t, s.key)
+		default:
+			if c, ok := t[s.key]; ok {
+				t[s.key] = deletePath(c, path[1:])
+			}
+		}
+	case []interface{}:
+		switch {
+		case s.wildcard && last:
+			return []interface{}{}
+		case s.wildcard:
+			for k, c := range t {
+				t[k] = deletePath(c, path[1:])
+			}
+		case !s.isIndex:
+		default:
+			i, ok := arrayIndex(t, s.index)
+			if !ok {
+				break
+			}
+			if last {
+				return append(t[:i], t[i+1:]...)
+			}
+			t[i] = deletePath(t[i], path[1:])
+		}
+	}
+	return v
+}
+
+// GetPath emits the value at a path in the inbound message. A path with a
+// wildcard emits an array of every matching value.
+func GetPath() Spec {
+	return Spec{
+		Name:    "getPath",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"path", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			p := in[1].(string)
+			path, err := parsePath(p)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			matches := getPath(in[0], path)
+			if hasWildcard(path) {
+				out[0] = Copy(matches)
+				return nil
+			}
+			// like get, a path that isn't in the message is null
+			if len(matches) == 0 {
+				out[0] = nil
+				return nil
+			}
+			out[0] = Copy(matches[0])
+			return nil
+		},
+	}
+}
+
+// SetPath emits a copy of the inbound message with the value at a path set,
+// creating any objects and arrays along the path that are missing
+func SetPath() Spec {
+	return Spec{
+		Name:    "setPath",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"path", STRING}, Pin{"value", ANY}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			p := in[1].(string)
+			path, err := parsePath(p)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			v, err := setPath(Copy(in[0]), path, in[2])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			out[0] = v
+			return nil
+		},
+	}
+}
+
+// DeletePath emits a copy of the inbound message without the value at a path
+func DeletePath() Spec {
+	return Spec{
+		Name:    "deletePath",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"path", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			p := in[1].(string)
+			path, err := parsePath(p)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			if len(path) == 0 {
+				out[0] = NewError("cannot delete the whole message")
+				return nil
+			}
+			out[0] = deletePath(Copy(in[0]), path)
+			return nil
+		},
+	}
+}
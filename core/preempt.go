@@ -0,0 +1,96 @@
+package core
+
+import "reflect"
+
+// the kernel of a block whose spec is marked Preempt is interrupted by every
+// message that arrives on the block's inputs while it runs. the interrupt
+// replaces the input's message, and the kernel runs again with the new
+// message and the internal state it left behind. this lets a kernel that
+// waits, like debounce, react to the messages that arrive while it waits.
+
+// preemptible returns a channel that carries the block's interrupts, along
+// with an interrupt for each message that arrives on an input. stop ends the
+// forwarding and returns an interrupt that was received but not passed on.
+func (b *Block) preemptible() (chan Interrupt, func() Interrupt) {
+	c := make(chan Interrupt)
+	quit := make(chan struct{})
+	left := make(chan Interrupt, 1)
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(quit)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(b.routing.InterruptChan)},
+	}
+	ids := []int{}
+	for id, input := range b.routing.Inputs {
+		if input.Value != nil {
+			continue
+		}
+		ids = append(ids, id)
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(input.C),
+		})
+	}
+
+	go func() {
+		for {
+			chosen, v, _ := reflect.Select(cases)
+			var f Interrupt
+			switch chosen {
+			case 0:
+				left <- nil
+				return
+			case 1:
+				f = v.Interface().(Interrupt)
+			default:
+				f = b.preemption(ids[chosen-2], v.Interface())
+			}
+			select {
+			case c <- f:
+			case <-quit:
+				left <- f
+				return
+			}
+		}
+	}()
+
+	return c, func() Interrupt {
+		close(quit)
+		return <-left
+	}
+}
+
+// preemption returns an interrupt that sets an input to a message that arrived
+// while the kernel was running.
+func (b *Block) preemption(id int, m Message) Interrupt {
+	return func() bool {
+		input := b.routing.Inputs[id]
+		if b.state.Processed {
+			// the kernel finished before the message arrived, so it
+			// belongs to the next crank
+			m = Untrace(m)
+		} else {
+			m = b.untrace(input.Name, m)
+		}
+		if b.typeCheck {
+			if err := b.checkType(id, false, m); err != nil {
+				b.rejectInput(id, m, err)
+				// while the kernel is still running the error is
+				// emitted along with its outputs
+				errorRoute := RouteIndex(len(b.routing.Outputs) - 1)
+				if _, ok := b.state.outputValues[errorRoute]; !ok && !b.state.Processed {
+					b.state.outputValues[errorRoute] = b.rejected
+					b.rejected = nil
+				}
+				return true
+			}
+		}
+		b.stats.count(&b.stats.In[id])
+		if b.state.Processed {
+			b.inputs.next[RouteIndex(id)] = m
+		} else {
+			b.state.inputValues[RouteIndex(id)] = m
+		}
+		return true
+	}
+}
@@ -26,16 +26,8 @@ func NormalRandom() Spec {
 		Inputs:  []Pin{Pin{"mean", NUMBER}, Pin{"variance", NUMBER}},
 		Outputs: []Pin{Pin{"draw", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			variance, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("variance must be a number")
-				return nil
-			}
-			mean, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("mean must be a number")
-				return nil
-			}
+			variance := in[1].(float64)
+			mean := in[0].(float64)
 			out[0] = rand.NormFloat64()*math.Sqrt(variance) + mean
 			return nil
 		},
@@ -55,21 +47,9 @@ func ZipfRandom() Spec {
 		Outputs: []Pin{Pin{"draw", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, ss Source, i chan Interrupt) Interrupt {
 
-			q, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("q must be a number")
-				return nil
-			}
-			s, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("s must be a number")
-				return nil
-			}
-			N, ok := in[2].(float64)
-			if !ok {
-				out[0] = NewError("N must be an number")
-				return nil
-			}
+			q := in[0].(float64)
+			s := in[1].(float64)
+			N := in[2].(float64)
 
 			z := rand.NewZipf(RAND, s, q, uint64(N))
 			out[0] = z.Uint64()
@@ -101,11 +81,7 @@ func PoissonRandom() Spec {
 		Inputs:  []Pin{Pin{"rate", NUMBER}},
 		Outputs: []Pin{Pin{"draw", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, ss Source, i chan Interrupt) Interrupt {
-			λ, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("rate must be a number")
-				return nil
-			}
+			λ := in[0].(float64)
 			if λ < 0 {
 				out[0] = NewError("rate must be positive")
 				return nil
@@ -123,11 +99,7 @@ func ExponentialRandom() Spec {
 		Inputs:  []Pin{Pin{"rate", NUMBER}},
 		Outputs: []Pin{Pin{"draw", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, ss Source, i chan Interrupt) Interrupt {
-			λ, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("rate must be a number")
-				return nil
-			}
+			λ := in[0].(float64)
 			if λ < 0 {
 				out[0] = NewError("rate must be positive")
 				return nil
@@ -146,11 +118,7 @@ func BernoulliRandom() Spec {
 		Outputs: []Pin{Pin{"draw", NUMBER}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			r := RAND.Float64()
-			p, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("bias must be a number")
-				return nil
-			}
+			p := in[0].(float64)
 			if p < 0 || p > 1 {
 				out[0] = NewError("bias must be between 0 and 1")
 			}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// a route is the path template and methods an endpoint receives requests for.
+// a template is a path like users/{id}/posts, where a segment in braces is a
+// variable that matches any one segment of a request's path. the leading and
+// trailing slashes of templates and paths are ignored. when more than one
+// route matches a path, the one with a literal segment where the others have
+// a variable wins.
+type route struct {
+	template string
+	segments []string
+	methods  []string // the methods the route accepts, or none for every method
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return []string{}
+	}
+	return strings.Split(p, "/")
+}
+
+func isVariable(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// parseRoute parses a path template and a method filter. The filter is a
+// comma separated list of methods like GET,POST, or empty or * for every
+// method.
+func parseRoute(template, method string) (route, error) {
+	r := route{segments: splitPath(template)}
+	r.template = "/" + strings.Join(r.segments, "/")
+
+	seen := make(map[string]bool)
+	for _, s := range r.segments {
+		if s == "" {
+			return route{}, NewError("empty segment in path " + template)
+		}
+		if !isVariable(s) {
+			if strings.ContainsAny(s, "{}") {
+				return route{}, NewError("bad segment " + s + " in path " + template)
+			}
+			continue
+		}
+		name := s[1 : len(s)-1]
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return route{}, NewError("bad variable " + s + " in path " + template)
+		}
+		if seen[name] {
+			return route{}, NewError("variable " + s + " appears twice in path " + template)
+		}
+		seen[name] = true
+	}
+
+	method = strings.TrimSpace(method)
+	if method == "" || method == "*" {
+		return r, nil
+	}
+	for _, m := range strings.Split(method, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			return route{}, NewError("empty method in " + method)
+		}
+		r.methods = append(r.methods, m)
+	}
+	sort.Strings(r.methods)
+	return r, nil
+}
+
+// key identifies the route. Endpoints with the same key share its requests.
+func (r route) key() string {
+	if len(r.methods) == 0 {
+		return "* " + r.template
+	}
+	return strings.Join(r.methods, ",") + " " + r.template
+}
+
+// match returns the values of the route's variables if it matches path.
+func (r route) match(path []string) (map[string]interface{}, bool) {
+	if len(path) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]interface{})
+	for i, s := range r.segments {
+		if isVariable(s) {
+			params[s[1:len(s)-1]] = path[i]
+		} else if s != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (r route) allows(method string) bool {
+	if len(r.methods) == 0 {
+		return true
+	}
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// before returns true if r should be matched before o.
+func (r route) before(o route) bool {
+	for i, s := range r.segments {
+		if v := isVariable(o.segments[i]); isVariable(s) != v {
+			return v
+		}
+	}
+	// a route that names its methods is more specific than one that doesn't
+	if (len(r.methods) == 0) != (len(o.methods) == 0) {
+		return len(o.methods) == 0
+	}
+	return r.key() < o.key()
+}
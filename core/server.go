@@ -1,15 +1,19 @@
 package core
 
 import (
+	"crypto/tls"
+	"errors"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fatih/structs"
-	"github.com/gorilla/mux"
 )
 
 func ServerSource() SourceSpec {
@@ -20,52 +24,201 @@ func ServerSource() SourceSpec {
 	}
 }
 
-type handlerRegistration struct {
-	c    chan Request
-	name string
+// a routeQueue hands the requests for a route to the endpoints registered for
+// it. the route stays registered while its endpoints run, so requests that
+// arrive while an endpoint is busy wait for it.
+type routeQueue struct {
+	route
+	c         chan Request
+	closed    chan struct{} // closed once the last endpoint unregisters
+	endpoints int           // the number of endpoints registered for the route
+	waiting   int           // the number of requests waiting for an endpoint
 }
 
+// a server listens on host:port, and serves HTTPS when both tlsCert and tlsKey
+// are set to the paths of a certificate and its key. its timeouts are
+// durations, where 0s is no timeout. the server can be restarted with new
+// parameters; endpoints keep their names across restarts.
+//
+// up to backlog requests for each route wait for an endpoint, for no longer
+// than queueTimeout. requests beyond the backlog, or that wait too long, get
+// a 503.
 type Server struct {
-	quit          chan bool
-	router        *mux.Router
-	routes        map[string]chan Request
-	addHandler    chan handlerRegistration
-	removeHandler chan string
-	port          int
+	quit         chan chan struct{} // carries a channel Serve closes once it has stopped
+	stopped      chan struct{}      // closed once the server has stopped
+	started      chan struct{}      // closed once the server has started serving
+	routes       map[string]*routeQueue
+	addr         net.Addr // the address the server is listening on
+	maxWaiting   int
+	maxWait      time.Duration
+	port         string
+	host         string
+	readTimeout  string
+	writeTimeout string
+	tlsCert      string
+	tlsKey       string
+	backlog      string
+	queueTimeout string
 	sync.Mutex
 }
 
-func (s Server) GetType() SourceType {
+func (s *Server) GetType() SourceType {
 	return SERVER
 }
 
 func (s *Server) SetSourceParameter(name, value string) {
 	switch name {
+	case "port":
+		s.port = value
+	case "host":
+		s.host = value
+	case "readTimeout":
+		s.readTimeout = value
+	case "writeTimeout":
+		s.writeTimeout = value
+	case "tlsCert":
+		s.tlsCert = value
+	case "tlsKey":
+		s.tlsKey = value
+	case "backlog":
+		s.backlog = value
+	case "queueTimeout":
+		s.queueTimeout = value
 	}
 }
 
 func (s *Server) Describe() []map[string]string {
 	return []map[string]string{
-		{"name": "port", "value": strconv.Itoa(s.port)},
+		{"name": "port", "value": s.port},
+		{"name": "host", "value": s.host},
+		{"name": "readTimeout", "value": s.readTimeout},
+		{"name": "writeTimeout", "value": s.writeTimeout},
+		{"name": "tlsCert", "value": s.tlsCert},
+		{"name": "tlsKey", "value": s.tlsKey},
+		{"name": "backlog", "value": s.backlog},
+		{"name": "queueTimeout", "value": s.queueTimeout},
 	}
 }
 
 func NewServer() Source {
 	server := &Server{
-		quit:          make(chan bool),
-		router:        mux.NewRouter().StrictSlash(true),
-		routes:        make(map[string]chan Request),
-		addHandler:    make(chan handlerRegistration),
-		removeHandler: make(chan string),
+		quit:         make(chan chan struct{}),
+		stopped:      make(chan struct{}),
+		started:      make(chan struct{}),
+		routes:       make(map[string]*routeQueue),
+		maxWaiting:   64,
+		maxWait:      10 * time.Second,
+		port:         "8080",
+		readTimeout:  "10s",
+		writeTimeout: "0s",
+		backlog:      "64",
+		queueTimeout: "10s",
 	}
 
 	return server
 }
 
+// ServeHTTP routes a request to the endpoint block registered for its path
+// and method. The server only has endpoints to route to while it is serving.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.Path)
+
+	var match *routeQueue
+	var params map[string]interface{}
+	allowed := make(map[string]bool)
+	s.Lock()
+	for _, q := range s.routes {
+		p, ok := q.match(path)
+		if !ok {
+			continue
+		}
+		if !q.allows(r.Method) {
+			for _, m := range q.methods {
+				allowed[m] = true
+			}
+			continue
+		}
+		if match == nil || q.before(match.route) {
+			match, params = q, p
+		}
+	}
+	full := match != nil && match.waiting >= s.maxWaiting
+	if match != nil && !full {
+		match.waiting++
+	}
+	wait := s.maxWait
+	s.Unlock()
+
+	if match == nil && len(allowed) > 0 {
+		methods := []string{}
+		for m := range allowed {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if match == nil {
+		log.Println("404")
+		http.NotFound(w, r)
+		return
+	}
+
+	if full {
+		http.Error(w, "endpoint backlog is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	c := make(chan error)
+	var reason string
+	select {
+	case match.c <- Request{w, c, r, params}:
+	case <-timeout:
+		reason = "timed out waiting for endpoint"
+	case <-match.closed:
+		reason = "endpoint was removed"
+	case <-r.Context().Done():
+		reason = "request was cancelled"
+	}
+	s.Lock()
+	match.waiting--
+	s.Unlock()
+	if reason != "" {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+
+	err := <-c
+	if err != nil {
+		log.Println(err)
+	}
+}
+
 type Request struct {
 	responseWriter http.ResponseWriter
 	respChan       chan error
 	request        *http.Request
+	params         map[string]interface{}
+}
+
+// Header returns the headers of the response, which can be changed until
+// the response's status is written.
+func (r Request) Header() http.Header {
+	return r.responseWriter.Header()
+}
+
+// WriteHeader writes the status of the response. The status has to be
+// written before the body.
+func (r Request) WriteHeader(status int) {
+	r.responseWriter.WriteHeader(status)
 }
 
 func (r Request) Write(p []byte) (n int, err error) {
@@ -86,92 +239,252 @@ func (r Request) Flush() {
 	}
 }
 
-func (s *Server) Serve() {
+// Addr returns the address the server is listening on, or nil if it isn't
+// listening.
+func (s *Server) Addr() net.Addr {
+	s.Lock()
+	defer s.Unlock()
+	return s.addr
+}
+
+// listen starts listening with the server's parameters.
+func (s *Server) listen() (*http.Server, net.Listener, error) {
+	port, err := strconv.Atoi(s.port)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, nil, errors.New("server port must be a number from 0 to 65535")
+	}
+	backlog, err := strconv.Atoi(s.backlog)
+	if err != nil || backlog < 1 {
+		return nil, nil, errors.New("server backlog must be a positive whole number")
+	}
+	timeouts := make([]time.Duration, 3)
+	for i, t := range []string{s.readTimeout, s.writeTimeout, s.queueTimeout} {
+		timeouts[i], err = time.ParseDuration(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		if timeouts[i] < 0 {
+			return nil, nil, errors.New("server timeouts cannot be negative")
+		}
+	}
 
 	server := &http.Server{
-		Addr:        ":8080",
-		Handler:     s.router,
-		ReadTimeout: 10 * time.Second,
-		//WriteTimeout:   0 * time.Second,
+		Addr:           net.JoinHostPort(s.host, strconv.Itoa(port)),
+		Handler:        s,
+		ReadTimeout:    timeouts[0],
+		WriteTimeout:   timeouts[1],
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	// base router
-	s.router.HandleFunc("/{name}", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		name := vars["name"]
-		outChan, ok := s.routes[name]
-		if !ok {
-			log.Println("404")
-			return
-		}
-		c := make(chan error)
-		outChan <- Request{w, c, r}
-		err := <-c
+	if (s.tlsCert == "") != (s.tlsKey == "") {
+		return nil, nil, errors.New("server tlsCert and tlsKey must be set together")
+	}
+	if s.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.tlsCert, s.tlsKey)
 		if err != nil {
-			log.Println(err)
+			return nil, nil, err
 		}
-	}).Methods("GET", "POST", "PUT", "DELETE")
-
-	log.Println("starting HTTP server on", server.Addr)
-	go server.ListenAndServe()
-	for {
-		select {
-		case <-s.quit:
-			return
-		case f := <-s.addHandler:
-			log.Println("registring new handler", f.name)
-			s.routes[f.name] = f.c
-		case name := <-s.removeHandler:
-			log.Println("removing handler", name)
-			delete(s.routes, name)
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if server.TLSConfig != nil {
+		ln = tls.NewListener(ln, server.TLSConfig)
+	}
+
+	s.Lock()
+	s.maxWaiting = backlog
+	s.maxWait = timeouts[2]
+	s.Unlock()
+	return server, ln, nil
+}
+
+func (s *Server) Serve() {
+	s.Lock()
+	select {
+	case <-s.stopped:
+		s.stopped = make(chan struct{})
+	default:
+	}
+	close(s.started)
+	s.Unlock()
+
+	// if the server can't listen it still registers endpoints, and waits for
+	// the user to update its parameters
+	server, ln, err := s.listen()
+	if err != nil {
+		log.Println(err)
+		log.Println("HTTP server is waiting for restart")
+	} else {
+		log.Println("starting HTTP server on", ln.Addr())
+		s.Lock()
+		s.addr = ln.Addr()
+		s.Unlock()
+		go server.Serve(ln)
+	}
+	done := <-s.quit
+	if server != nil {
+		// the listener is closed here too, as server.Serve may not have
+		// started tracking it yet
+		server.Close()
+		ln.Close()
+	}
+	s.Lock()
+	s.addr = nil
+	close(s.stopped)
+	s.started = make(chan struct{})
+	s.Unlock()
+	close(done)
+}
+
+// Stop stops the server, and waits for it to stop listening.
+func (s *Server) Stop() {
+	done := make(chan struct{})
+	s.quit <- done
+	<-done
+}
+
+// register registers an endpoint for a route, and returns the route's queue of
+// requests. It returns false if the server has been stopped.
+func (s *Server) register(r route) (*routeQueue, bool) {
+	s.Lock()
+	defer s.Unlock()
+	select {
+	case <-s.stopped:
+		return nil, false
+	default:
+	}
+	q, ok := s.routes[r.key()]
+	if !ok {
+		log.Println("registring new handler", r.key())
+		q = &routeQueue{
+			route:  r,
+			c:      make(chan Request),
+			closed: make(chan struct{}),
 		}
+		s.routes[r.key()] = q
 	}
+	q.endpoints++
+	return q, true
 }
 
-func (s Server) Stop() {
-	s.quit <- true
+// unregister unregisters an endpoint from a route. The route is removed once
+// its last endpoint has gone, and requests still waiting for it get a 503.
+func (s *Server) unregister(q *routeQueue) {
+	s.Lock()
+	defer s.Unlock()
+	q.endpoints--
+	if q.endpoints > 0 || s.routes[q.key()] != q {
+		return
+	}
+	log.Println("removing handler", q.key())
+	close(q.closed)
+	delete(s.routes, q.key())
 }
 
+// FromRequest receives HTTP requests whose path matches the path template in
+// name, and whose method passes the method filter. The endpoint stays
+// registered with the server until its route changes or the block stops or is
+// reset, so requests that arrive while it is busy wait for it. Endpoints with
+// the same route share its requests.
+//
 // OutPin 0: received request
+//
+// OutPin 3: the values of the template's variables
 func FromRequest() Spec {
 	return Spec{
 		Name: "endpoint",
 		Inputs: []Pin{
 			Pin{"name", STRING},
+			Pin{"method", STRING},
 		},
 		Outputs: []Pin{
 			Pin{"request", OBJECT},
 			Pin{"writer", WRITER},
 			Pin{"body", STRING},
+			Pin{"params", OBJECT},
 		},
 		Source: SERVER,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			server := s.(*Server)
-			name, ok := in[0].(string)
-			if !ok {
-				log.Fatal("inputs must be strings")
+			name := in[0].(string)
+			method := in[1].(string)
+			r, err := parseRoute(name, method)
+
+			// internal[1] and internal[2] hold the route the endpoint
+			// registered and the server it registered with
+			q, registered := internal[1].(*routeQueue)
+			if registered && (err != nil || q.key() != r.key() || internal[2] != server) {
+				internal[2].(*Server).unregister(q)
+				delete(internal, 1)
+				delete(internal, 2)
+				registered = false
+			}
+
+			// an endpoint runs continuously, so after reporting a bad
+			// route it waits for a new one
+			if internal[0] == name+" "+method {
+				return <-i
+			}
+			if err != nil {
+				internal[0] = name + " " + method
+				out[0] = err
+				return nil
 			}
+			delete(internal, 0)
 
-			requests := make(chan Request)
+			// a stopped server receives no more requests until it is
+			// restarted
+			if !registered {
+				var ok bool
+				q, ok = server.register(r)
+				if !ok {
+					server.Lock()
+					started := server.started
+					server.Unlock()
+					select {
+					case <-started:
+						return nil
+					case f := <-i:
+						return f
+					}
+				}
+				internal[1] = q
+				internal[2] = server
+			}
 
-			server.addHandler <- handlerRegistration{requests, name}
 			select {
-			case r := <-requests:
-				body, err := ioutil.ReadAll(r.request.Body)
+			case req := <-q.c:
+				body, err := ioutil.ReadAll(req.request.Body)
 				if err != nil {
 					out[0] = NewError("could not read body")
 					return nil
 				}
-				out[0] = structs.Map(r.request)
-				out[1] = r
+				out[0] = structs.Map(req.request)
+				out[1] = req
 				out[2] = string(body)
-				server.removeHandler <- name
+				out[3] = req.params
+			case <-q.closed:
+				// the route has been removed, so register it again
+				delete(internal, 1)
+				delete(internal, 2)
+				return nil
 			case f := <-i:
-				server.removeHandler <- name
 				return f
 			}
 			return nil
 		},
+		Cleanup: func(internal MessageMap) {
+			// a block is cleaned up when it stops and again when it is
+			// reset, but only unregisters once
+			if q, ok := internal[1].(*routeQueue); ok {
+				internal[2].(*Server).unregister(q)
+				delete(internal, 1)
+				delete(internal, 2)
+			}
+		},
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"log"
 	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/bitly/go-nsq"
 )
@@ -17,6 +18,7 @@ func NSQInterface() SourceSpec {
 }
 
 type NSQ struct {
+	received    uint64 // messages received from NSQ. first, so that it is aligned for atomic access
 	quit        chan bool
 	Out         chan Message // this channel is used by any block that would like to receive messages
 	topic       string
@@ -65,7 +67,7 @@ func NewNSQ() Source {
 	return stream
 }
 
-func (s NSQ) Serve() {
+func (s *NSQ) Serve() {
 	conf := nsq.NewConfig()
 	m, err := strconv.Atoi(s.maxInFlight)
 	if err != nil {
@@ -101,11 +103,17 @@ Wait:
 	}
 }
 
-func (s NSQ) HandleMessage(message *nsq.Message) error {
+func (s *NSQ) HandleMessage(message *nsq.Message) error {
+	atomic.AddUint64(&s.received, 1)
 	s.Out <- string(message.Body)
 	return nil
 }
 
+// Received returns the number of messages the stream has received from NSQ.
+func (s *NSQ) Received() uint64 {
+	return atomic.LoadUint64(&s.received)
+}
+
 func (s NSQ) Stop() {
 	s.quit <- true
 }
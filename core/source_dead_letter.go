@@ -0,0 +1,146 @@
+package core
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+func DeadLetterStore() SourceSpec {
+	return SourceSpec{
+		Name: "dead_letter",
+		Type: DEAD_LETTER,
+		New:  NewDeadLetter,
+	}
+}
+
+func NewDeadLetter() Source {
+	return &DeadLetter{
+		letters: make([]*ErrorMessage, 0),
+		quit:    make(chan bool),
+	}
+}
+
+// DeadLetter holds the ErrorMessages of messages that caused kernel errors, so
+// that they can be inspected and replayed once the pattern has been fixed.
+type DeadLetter struct {
+	letters []*ErrorMessage
+	quit    chan bool
+	sync.Mutex
+}
+
+func (d *DeadLetter) GetType() SourceType {
+	return DEAD_LETTER
+}
+
+func (d *DeadLetter) Get() interface{} {
+	letters := make([]*ErrorMessage, len(d.letters))
+	copy(letters, d.letters)
+	return letters
+}
+
+// Set replaces the stored letters. v must be an array of objects in the form
+// emitted by Get.
+func (d *DeadLetter) Set(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var letters []*ErrorMessage
+	err = json.Unmarshal(b, &letters)
+	if err != nil {
+		return err
+	}
+	if letters == nil {
+		letters = make([]*ErrorMessage, 0)
+	}
+	d.letters = letters
+	return nil
+}
+
+// Push appends letters to the store.
+func (d *DeadLetter) Push(letters ...*ErrorMessage) {
+	d.letters = append(d.letters, letters...)
+}
+
+// Drain removes and returns all stored letters.
+func (d *DeadLetter) Drain() []*ErrorMessage {
+	letters := d.letters
+	d.letters = make([]*ErrorMessage, 0)
+	return letters
+}
+
+// deadLetter stores the inbound error. Connect a block's error output to
+// deadLetter to capture the messages that caused it to fail.
+func deadLetter() Spec {
+	return Spec{
+		Name: "deadLetter",
+		Inputs: []Pin{
+			Pin{"error", ERROR},
+		},
+		Outputs: []Pin{},
+		Source:  DEAD_LETTER,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			d := s.(*DeadLetter)
+			letter, ok := in[0].(*ErrorMessage)
+			if !ok {
+				letter = &ErrorMessage{
+					Text:   errorText(in[0]),
+					Inputs: []Message{},
+				}
+			}
+			d.Push(letter)
+			return nil
+		},
+	}
+}
+
+// deadLetterPop emits the oldest stored letter along with the inputs that
+// caused it, removing it from the store.
+func deadLetterPop() Spec {
+	return Spec{
+		Name: "deadLetterPop",
+		Inputs: []Pin{
+			Pin{"trigger", ANY},
+		},
+		Outputs: []Pin{
+			Pin{"letter", ERROR},
+			Pin{"inputs", ARRAY},
+		},
+		Source: DEAD_LETTER,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			d := s.(*DeadLetter)
+			if len(d.letters) == 0 {
+				out[ErrorRoute] = NewError("empty dead letter")
+				return nil
+			}
+			var letter *ErrorMessage
+			letter, d.letters = d.letters[0], d.letters[1:]
+			inputs := make([]interface{}, len(letter.Inputs))
+			for i, m := range letter.Inputs {
+				inputs[i] = Copy(m)
+			}
+			out[0] = letter
+			out[1] = inputs
+			return nil
+		},
+	}
+}
+
+// deadLetterDump emits every stored letter
+func deadLetterDump() Spec {
+	return Spec{
+		Name:    "deadLetterDump",
+		Inputs:  []Pin{Pin{"trigger", ANY}},
+		Outputs: []Pin{Pin{"letters", ARRAY}},
+		Source:  DEAD_LETTER,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			d := s.(*DeadLetter)
+			letters := make([]interface{}, len(d.letters))
+			for i, l := range d.letters {
+				letters[i] = l
+			}
+			out[0] = letters
+			return nil
+		},
+	}
+}
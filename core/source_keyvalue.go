@@ -56,11 +56,7 @@ func kvGet() Spec {
 		Source: KEY_VALUE,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			kv := s.(*KeyValue)
-			key, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("Key is not type string")
-				return nil
-			}
+			key := in[0].(string)
 
 			if value, ok := kv.kv[key]; !ok {
 				out[0] = NewError("Key not found")
@@ -87,11 +83,7 @@ func kvSet() Spec {
 		Source: KEY_VALUE,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			kv := s.(*KeyValue)
-			key, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("Key is not type string")
-				return nil
-			}
+			key := in[0].(string)
 
 			if _, ok := kv.kv[key]; !ok {
 				out[0] = true
@@ -166,11 +158,7 @@ func kvDelete() Spec {
 		Source: KEY_VALUE,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			kv := s.(*KeyValue)
-			key, ok := in[0].(string)
-			if !ok {
-				out[0] = NewError("Key is not type string")
-				return nil
-			}
+			key := in[0].(string)
 
 			if _, ok := kv.kv[key]; !ok {
 				out[0] = false
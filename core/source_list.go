@@ -34,6 +34,13 @@ func (l *List) Get() interface{} {
 	return l.list
 }
 
+// Len returns the number of elements in the list.
+func (l *List) Len() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.list)
+}
+
 func (l *List) Set(v interface{}) error {
 	list, ok := v.([]interface{})
 	if !ok {
@@ -56,11 +63,7 @@ func listGet() Spec {
 		Source: LIST,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			l := s.(*List)
-			indexFloat, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("List index is not a Number ")
-				return nil
-			}
+			indexFloat := in[0].(float64)
 			index := int(indexFloat)
 			/*
 				// TODO should we be happy with int() just flooring the index?
@@ -96,11 +99,7 @@ func listSet() Spec {
 		Source: LIST,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			l := s.(*List)
-			indexFloat, ok := in[0].(float64)
-			if !ok {
-				out[0] = NewError("List index is not a Number ")
-				return nil
-			}
+			indexFloat := in[0].(float64)
 			index := int(indexFloat)
 			/*
 				// TODO should we be happy with int() just flooring the index?
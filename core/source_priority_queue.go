@@ -38,6 +38,11 @@ func (pq PriorityQueue) GetType() SourceType {
 	return PRIORITY
 }
 
+// Len returns the number of messages in the queue.
+func (pq *PriorityQueue) Len() int {
+	return pq.queue.Size()
+}
+
 func pqPush() Spec {
 	return Spec{
 		Name: "pqPush",
@@ -51,11 +56,7 @@ func pqPush() Spec {
 		Source: PRIORITY,
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
 			pq := s.(*PriorityQueue)
-			priority, ok := in[1].(float64)
-			if !ok {
-				out[0] = NewError("pqPush needs a Number for a priority")
-				return nil
-			}
+			priority := in[1].(float64)
 			pq.queue.Push(in[0], int(priority))
 			out[0] = true
 			return nil
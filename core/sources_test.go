@@ -1,10 +1,18 @@
 package core
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
 	"testing"
 	"time"
+
+	"github.com/nytlabs/st-core/core/nettest"
 )
 
 func TestList(t *testing.T) {
@@ -267,3 +275,174 @@ func TestPriorityQueue(t *testing.T) {
 	}
 
 }
+
+func TestDeadLetter(t *testing.T) {
+	log.Println("testing dead letter")
+	d := NewDeadLetter()
+	if d.GetType() != DEAD_LETTER {
+		t.Fatal("dead letter returns inaccurate id")
+	}
+
+	library := GetLibrary()
+	add := NewBlock(library["+"])
+	dl := NewBlock(library["deadLetter"])
+	pop := NewBlock(library["deadLetterPop"])
+	for _, b := range []*Block{add, dl, pop} {
+		go DummyMonitor(b.Monitor)
+		go b.Serve()
+	}
+	add.SetID(1)
+	dl.SetSource(d)
+	pop.SetSource(d)
+
+	// wire the adder's error output into the dead letter
+	in, _ := dl.GetInput(0)
+	add.Connect(1, in.C)
+
+	x, _ := add.GetInput(0)
+	y, _ := add.GetInput(1)
+	x.C <- "one"
+	y.C <- 2.0
+
+	// wait for the letter to be stored
+	for i := 0; i < 100; i++ {
+		d.Lock()
+		n := len(d.(*DeadLetter).letters)
+		d.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	letters := make(chan Message)
+	inputs := make(chan Message)
+	pop.Connect(0, letters)
+	pop.Connect(1, inputs)
+	trigger, _ := pop.GetInput(0)
+	trigger.C <- nil
+
+	letter, ok := (<-letters).(*ErrorMessage)
+	if !ok {
+		t.Fatal("deadLetterPop did not emit an ErrorMessage")
+	}
+	if letter.Block != 1 || letter.Pin != "x" {
+		t.Error("letter did not record its block and pin")
+	}
+	if fmt.Sprint(<-inputs) != fmt.Sprint([]interface{}{"one", 2.0}) {
+		t.Error("letter did not record its inputs")
+	}
+}
+
+func TestServer(t *testing.T) {
+	log.Println("testing server")
+
+	// waitFor polls until f returns true
+	waitFor := func(what string, f func() bool) {
+		for deadline := time.Now().Add(time.Second); !f(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for", what)
+			}
+		}
+	}
+	listening := func(s *Server) func() bool {
+		return func() bool { return s.Addr() != nil }
+	}
+
+	// two servers can listen at once on their own ports
+	servers := []*Server{NewServer().(*Server), NewServer().(*Server)}
+	for _, s := range servers {
+		s.SetSourceParameter("host", "127.0.0.1")
+		s.SetSourceParameter("port", "0")
+		s.SetSourceParameter("readTimeout", "1s")
+		s.SetSourceParameter("writeTimeout", "1s")
+		go s.Serve()
+		waitFor("server to listen", listening(s))
+		resp, err := http.Get("http://" + s.Addr().String() + "/nothing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if servers[0].Addr().String() == servers[1].Addr().String() {
+		t.Error("servers share an address")
+	}
+	servers[1].Stop()
+	if servers[1].Addr() != nil {
+		t.Error("stopped server is still listening")
+	}
+
+	// restarting a server on a fixed port in quick succession waits for
+	// each listener to close, so the last restart can listen
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	servers[1].SetSourceParameter("port", strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	go servers[1].Serve()
+	waitFor("server to listen", listening(servers[1]))
+	for n := 0; n < 3; n++ {
+		servers[1].Stop()
+		go servers[1].Serve()
+	}
+	waitFor("restarted server to listen", listening(servers[1]))
+	servers[1].Stop()
+
+	// an endpoint registers while the server is stopped once it restarts
+	server := servers[0]
+	server.Stop()
+	endpoint := NewBlock(GetLibrary()["endpoint"])
+	go DummyMonitor(endpoint.Monitor)
+	go endpoint.Serve()
+	endpoint.SetSource(server)
+	endpoint.SetInput(1, &InputValue{""})
+	endpoint.SetInput(0, &InputValue{"later"})
+	registered := func() bool {
+		server.Lock()
+		defer server.Unlock()
+		_, ok := server.routes["* /later"]
+		return ok
+	}
+
+	// bad parameters leave the server waiting to be restarted
+	server.SetSourceParameter("readTimeout", "soon")
+	go server.Serve()
+	waitFor("endpoint to register", registered)
+	if server.Addr() != nil {
+		t.Error("server is listening with a bad timeout")
+	}
+	server.Stop()
+
+	// restarting with a certificate serves HTTPS
+	dir, err := ioutil.TempDir("", "stcore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key, err := nettest.WriteCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetSourceParameter("readTimeout", "1s")
+	server.SetSourceParameter("tlsCert", cert)
+	server.SetSourceParameter("tlsKey", key)
+	go server.Serve()
+	defer server.Stop()
+	waitFor("server to listen", listening(server))
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + server.Addr().String() + "/nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil {
+		t.Error("server did not serve HTTPS")
+	}
+	if !registered() {
+		t.Error("endpoint was lost when the server restarted")
+	}
+}
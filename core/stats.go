@@ -0,0 +1,110 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// every block keeps statistics on the messages that pass through it and on
+// the time it spends in each stage of its crank. the statistics can be read
+// with Stats while the block is running.
+
+// KernelBuckets are the upper bounds, in seconds, of the buckets that kernel
+// execution times are counted in.
+var KernelBuckets = []float64{.00001, .0001, .001, .01, .1, 1, 10}
+
+// A Histogram counts observations into buckets. Counts[i] is the number of
+// observations greater than Bounds[i-1] and no greater than Bounds[i]. The
+// last count holds the observations greater than every bound.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+func NewHistogram(bounds []float64) Histogram {
+	return Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe counts v into the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.Bounds) && v > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// Add adds the observations of o, which must have the same bounds, to the
+// histogram.
+func (h *Histogram) Add(o Histogram) {
+	for i, c := range o.Counts {
+		h.Counts[i] += c
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+}
+
+// BlockStats describes what a block has done since it was created.
+type BlockStats struct {
+	In           []uint64  `json:"in"`           // messages received on each input
+	Out          []uint64  `json:"out"`          // messages emitted on each output
+	Errors       uint64    `json:"errors"`       // errors emitted or discarded by the block
+	Kernel       Histogram `json:"kernel"`       // kernel execution time in seconds
+	Receiving    float64   `json:"receiving"`    // seconds spent waiting for inputs
+	Broadcasting float64   `json:"broadcasting"` // seconds spent waiting to deliver outputs
+}
+
+type blockStats struct {
+	BlockStats
+	sync.Mutex
+}
+
+func newBlockStats(inputs, outputs int) blockStats {
+	return blockStats{
+		BlockStats: BlockStats{
+			In:     make([]uint64, inputs),
+			Out:    make([]uint64, outputs),
+			Kernel: NewHistogram(KernelBuckets),
+		},
+	}
+}
+
+func (s *blockStats) count(c *uint64) {
+	s.Lock()
+	*c++
+	s.Unlock()
+}
+
+// wait adds the time since start to a total of seconds spent waiting.
+func (s *blockStats) wait(total *float64, start time.Time) {
+	d := time.Since(start).Seconds()
+	s.Lock()
+	*total += d
+	s.Unlock()
+}
+
+func (s *blockStats) kernel(start time.Time) {
+	d := time.Since(start).Seconds()
+	s.Lock()
+	s.Kernel.Observe(d)
+	s.Unlock()
+}
+
+// Stats returns a copy of the block's statistics.
+func (b *Block) Stats() BlockStats {
+	b.stats.Lock()
+	defer b.stats.Unlock()
+
+	s := b.stats.BlockStats
+	s.In = append([]uint64{}, s.In...)
+	s.Out = append([]uint64{}, s.Out...)
+	s.Kernel.Counts = append([]uint64{}, s.Kernel.Counts...)
+	return s
+}
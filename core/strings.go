@@ -8,12 +8,8 @@ func StringConcat() Spec {
 		Inputs:  []Pin{Pin{"a", STRING}, Pin{"b", STRING}},
 		Outputs: []Pin{Pin{"a+b", STRING}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			a, ok := in[0].(string)
-			b, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("concat requires string")
-				return nil
-			}
+			a := in[0].(string)
+			b := in[1].(string)
 			out[0] = a + b
 			return nil
 		},
@@ -26,12 +22,8 @@ func StringSplit() Spec {
 		Inputs:  []Pin{Pin{"a<sep>b", STRING}, Pin{"sep", STRING}},
 		Outputs: []Pin{Pin{"[a,b]", ARRAY}},
 		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
-			ab, ok := in[0].(string)
-			sep, ok := in[1].(string)
-			if !ok {
-				out[0] = NewError("split requires string")
-				return nil
-			}
+			ab := in[0].(string)
+			sep := in[1].(string)
 			seperatedStrings := strings.Split(ab, sep)
 			sepI := make([]interface{}, len(seperatedStrings))
 			for i, v := range seperatedStrings {
@@ -0,0 +1,242 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// a block's sync mode decides when it has received enough messages to run its
+// kernel. by default a block waits for a message on every input. a block can
+// instead run whenever any input receives a message, using the last message
+// received on each of its other inputs, or wait for every input for no longer
+// than a time window, running with nil for the inputs that are still missing.
+
+type SyncMode uint8
+
+const (
+	SYNC_ALL SyncMode = iota
+	SYNC_ANY
+	SYNC_WINDOW
+)
+
+func (s SyncMode) MarshalJSON() ([]byte, error) {
+	switch s {
+	case SYNC_ALL:
+		return []byte(`"all"`), nil
+	case SYNC_ANY:
+		return []byte(`"any"`), nil
+	case SYNC_WINDOW:
+		return []byte(`"window"`), nil
+	}
+	return nil, errors.New("unknown sync mode")
+}
+
+func (s *SyncMode) UnmarshalJSON(data []byte) error {
+	var v string
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	switch v {
+	case "all", "":
+		*s = SYNC_ALL
+	case "any":
+		*s = SYNC_ANY
+	case "window":
+		*s = SYNC_WINDOW
+	default:
+		return errors.New("unknown sync mode " + v)
+	}
+	return nil
+}
+
+// inputSync holds a block's sync mode and the state it keeps between cranks.
+type inputSync struct {
+	mode     SyncMode
+	window   time.Duration
+	latest   MessageMap // the last message received on each input
+	fresh    bool       // true once a message has been received this crank
+	deadline time.Time  // the end of the current window
+	next     MessageMap // messages received for the next crank
+}
+
+// SetSync sets the block's sync mode. The window is only used by SYNC_WINDOW,
+// and must be positive for it.
+func (b *Block) SetSync(mode SyncMode, window time.Duration) error {
+	if mode > SYNC_WINDOW {
+		return errors.New("unknown sync mode")
+	}
+	if mode == SYNC_WINDOW && window <= 0 {
+		return errors.New("sync window must be positive")
+	}
+	b.routing.InterruptChan <- func() bool {
+		b.inputs.mode = mode
+		b.inputs.window = window
+		b.inputs.deadline = time.Time{}
+		return true
+	}
+	return nil
+}
+
+// receiveAny waits for a message on any input, then fills the rest of the
+// inputs with the last message they received. Until every input has received
+// a message the block keeps waiting. Messages that preempted the last
+// crank's kernel are already in the block's input values, and count as the
+// latest on their inputs.
+func (b *Block) receiveAny() Interrupt {
+	b.Monitor <- MonitorMessage{
+		BI_INPUT,
+		nil,
+	}
+
+	for k, m := range b.state.inputValues {
+		if b.routing.Inputs[k].Value == nil {
+			b.inputs.latest[k] = Copy(m)
+			b.inputs.fresh = true
+		}
+	}
+
+	for {
+		waiting := []int{}
+		ready := true
+		for id, input := range b.routing.Inputs {
+			if input.Value != nil {
+				continue
+			}
+			waiting = append(waiting, id)
+			if _, ok := b.inputs.latest[RouteIndex(id)]; !ok {
+				ready = false
+			}
+		}
+
+		if ready && (b.inputs.fresh || len(waiting) == 0) {
+			for id, input := range b.routing.Inputs {
+				if _, ok := b.state.inputValues[RouteIndex(id)]; ok {
+					continue
+				}
+				if input.Value != nil {
+					b.state.inputValues[RouteIndex(id)] = Copy(input.Value.Data)
+				} else {
+					b.state.inputValues[RouteIndex(id)] = Copy(b.inputs.latest[RouteIndex(id)])
+				}
+			}
+			return nil
+		}
+
+		id, m, f, _ := b.receiveNext(waiting, nil)
+		if f != nil {
+			return f
+		}
+		if b.rejected != nil {
+			b.emitRejected()
+			return nil
+		}
+		b.inputs.latest[RouteIndex(id)] = m
+		b.inputs.fresh = true
+	}
+}
+
+// receiveWindow waits for a message on every input. Once the first message of
+// a crank has arrived, the rest have to arrive within the block's window, or
+// the inputs that are missing are set to nil.
+func (b *Block) receiveWindow() Interrupt {
+	b.Monitor <- MonitorMessage{
+		BI_INPUT,
+		nil,
+	}
+
+	for {
+		waiting := []int{}
+		for id, input := range b.routing.Inputs {
+			if _, ok := b.state.inputValues[RouteIndex(id)]; ok {
+				continue
+			}
+			if input.Value != nil {
+				b.state.inputValues[RouteIndex(id)] = Copy(input.Value.Data)
+				continue
+			}
+			waiting = append(waiting, id)
+		}
+
+		if len(waiting) == 0 {
+			return nil
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !b.inputs.deadline.IsZero() {
+			timer = time.NewTimer(b.inputs.deadline.Sub(time.Now()))
+			timeout = timer.C
+		}
+
+		id, m, f, expired := b.receiveNext(waiting, timeout)
+		if timer != nil {
+			timer.Stop()
+		}
+		if f != nil {
+			return f
+		}
+		if b.rejected != nil {
+			b.emitRejected()
+			return nil
+		}
+		if expired {
+			for _, id := range waiting {
+				b.state.inputValues[RouteIndex(id)] = nil
+			}
+			return nil
+		}
+		b.state.inputValues[RouteIndex(id)] = m
+		if b.inputs.deadline.IsZero() {
+			b.inputs.deadline = time.Now().Add(b.inputs.window)
+		}
+	}
+}
+
+// receiveNext waits for the next message on any of the inputs in ids. It
+// returns an interrupt if one arrives first, or true if the timeout passes
+// first. A message rejected by type checking returns nothing, and leaves the
+// block's rejected input set.
+func (b *Block) receiveNext(ids []int, timeout <-chan time.Time) (int, Message, Interrupt, bool) {
+	cases := []reflect.SelectCase{{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(b.routing.InterruptChan),
+	}}
+	if timeout != nil {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(timeout),
+		})
+	}
+	offset := len(cases)
+	for _, id := range ids {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(b.routing.Inputs[id].C),
+		})
+	}
+
+	for {
+		chosen, v, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return 0, nil, v.Interface().(Interrupt), false
+		}
+		if chosen < offset {
+			return 0, nil, nil, true
+		}
+
+		id := ids[chosen-offset]
+		input := b.routing.Inputs[id]
+		m := b.untrace(input.Name, v.Interface())
+		if b.typeCheck {
+			if err := b.checkType(id, false, m); err != nil {
+				b.rejectInput(id, m, err)
+				return 0, nil, nil, false
+			}
+		}
+		b.stats.count(&b.stats.In[id])
+		return id, m, nil, false
+	}
+}
@@ -0,0 +1,44 @@
+package core
+
+import "errors"
+
+// Tap sends a copy of every message that the output delivers to connection c
+// on tap. Copies are dropped rather than sent if tap is full, so a tap never
+// holds up the block, and an unbuffered tap receives nothing. A nil tap
+// removes the output's tap on c.
+func (b *Block) Tap(id RouteIndex, c Connection, tap chan Message) error {
+	returnVal := make(chan error, 1)
+	b.routing.InterruptChan <- func() bool {
+		if int(id) < 0 || int(id) >= len(b.routing.Outputs) {
+			returnVal <- errors.New("output out of range")
+			return true
+		}
+
+		if _, ok := b.routing.Outputs[id].Connections[c]; !ok {
+			returnVal <- errors.New("connection does not exist")
+			return true
+		}
+
+		if tap == nil {
+			delete(b.taps, ManifestPair{int(id), c})
+		} else {
+			b.taps[ManifestPair{int(id), c}] = tap
+		}
+		returnVal <- nil
+		return true
+	}
+	return <-returnVal
+}
+
+// tap sends a copy of a message delivered on an output to the connection's
+// tap, if it has one.
+func (b *Block) tap(id int, c Connection, m Message) {
+	tap, ok := b.taps[ManifestPair{id, c}]
+	// the block is the only sender on a tap, so if there is room now there
+	// is room when we send. checking first saves copying messages that
+	// would be dropped.
+	if !ok || len(tap) == cap(tap) {
+		return
+	}
+	tap <- Copy(m)
+}
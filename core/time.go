@@ -1,6 +1,9 @@
 package core
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 func Timestamp() Spec {
 	return Spec{
@@ -13,3 +16,217 @@ func Timestamp() Spec {
 		},
 	}
 }
+
+// Ticker emits a timestamp every interval
+func Ticker() Spec {
+	return Spec{
+		Name:    "ticker",
+		Inputs:  []Pin{Pin{"interval", STRING}},
+		Outputs: []Pin{Pin{"timestamp", NUMBER}},
+		Preempt: true,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			v, _ := in[0].(string)
+			if internal[1] != v {
+				internal[1] = v
+				delete(internal, 0)
+				interval, err := time.ParseDuration(v)
+				if err == nil && interval <= 0 {
+					err = NewError("ticker interval must be positive")
+				}
+				if err != nil {
+					out[0] = err
+					return nil
+				}
+				internal[0] = time.Now().Add(interval)
+				internal[2] = interval
+			}
+
+			// a block with a fixed interval runs continuously, so after
+			// reporting a bad interval it waits for a new one
+			next, ok := internal[0].(time.Time)
+			if !ok {
+				return <-i
+			}
+			interval := internal[2].(time.Duration)
+
+			timer := time.NewTimer(next.Sub(time.Now()))
+			select {
+			case <-timer.C:
+				out[0] = float64(next.UnixNano() / 1000000)
+				// ticks missed while the block was busy are skipped
+				now := time.Now()
+				for !next.After(now) {
+					next = next.Add(interval)
+				}
+				internal[0] = next
+				return nil
+			case f := <-i:
+				timer.Stop()
+				return f
+			}
+		},
+	}
+}
+
+// Throttle emits at most count messages per interval, dropping the rest
+func Throttle() Spec {
+	return Spec{
+		Name:    "throttle",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"count", NUMBER}, Pin{"interval", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			count, ok := in[1].(float64)
+			if !ok || count < 1 {
+				out[0] = NewError("throttle count must be at least 1")
+				return nil
+			}
+			v, _ := in[2].(string)
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+
+			// the times of the messages emitted during the last interval
+			now := time.Now()
+			sent, _ := internal[0].([]time.Time)
+			for len(sent) > 0 && now.Sub(sent[0]) >= interval {
+				sent = sent[1:]
+			}
+			if len(sent) < int(count) {
+				sent = append(sent, now)
+				out[0] = in[0]
+			}
+			internal[0] = sent
+			return nil
+		},
+	}
+}
+
+// Debounce emits a message once no other message has arrived for quiet
+func Debounce() Spec {
+	return Spec{
+		Name:    "debounce",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"quiet", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Preempt: true,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			v, _ := in[1].(string)
+			t, err := time.ParseDuration(v)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			// a new message interrupts the wait, and the kernel starts
+			// waiting again with the new message
+			timer := time.NewTimer(t)
+			select {
+			case <-timer.C:
+				out[0] = in[0]
+				return nil
+			case f := <-i:
+				timer.Stop()
+				return f
+			}
+		},
+	}
+}
+
+// Sample emits the latest message it has received once every interval
+func Sample() Spec {
+	return Spec{
+		Name:    "sample",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"interval", STRING}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Preempt: true,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			v, _ := in[1].(string)
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			if interval <= 0 {
+				out[0] = NewError("sample interval must be positive")
+				return nil
+			}
+
+			// samples are taken on a fixed schedule, skipping the
+			// samples of intervals without messages
+			now := time.Now()
+			next, ok := internal[0].(time.Time)
+			if !ok {
+				next = now.Add(interval)
+			}
+			for !next.After(now) {
+				next = next.Add(interval)
+			}
+			internal[0] = next
+
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+				out[0] = in[0]
+				internal[0] = next.Add(interval)
+				return nil
+			case f := <-i:
+				timer.Stop()
+				return f
+			}
+		},
+	}
+}
+
+// a token bucket holds up to burst tokens, and gains rate tokens a second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit emits messages at no more than rate messages per second, allowing
+// bursts of up to burst messages. Messages wait until they can be emitted.
+func RateLimit() Spec {
+	return Spec{
+		Name:    "rateLimit",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"rate", NUMBER}, Pin{"burst", NUMBER}},
+		Outputs: []Pin{Pin{"out", ANY}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			rate, ok := in[1].(float64)
+			if !ok || rate <= 0 {
+				out[0] = NewError("rate must be a positive number")
+				return nil
+			}
+			burst, ok := in[2].(float64)
+			if !ok || burst < 1 {
+				out[0] = NewError("burst must be at least 1")
+				return nil
+			}
+
+			bucket, ok := internal[0].(*tokenBucket)
+			if !ok {
+				bucket = &tokenBucket{burst, time.Now()}
+				internal[0] = bucket
+			}
+
+			for {
+				now := time.Now()
+				bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+				bucket.last = now
+				if bucket.tokens >= 1 {
+					bucket.tokens--
+					out[0] = in[0]
+					return nil
+				}
+
+				wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case f := <-i:
+					timer.Stop()
+					return f
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"time"
+)
+
+// messages that enter a pattern through an ingress block, a block that reads
+// from a stream or a server, can be traced. a traced message travels between
+// blocks wrapped with the ids of the traces it belongs to. every block that
+// handles a traced message unwraps it before running its kernel, and wraps
+// the messages it emits during the same crank with the same traces, so that
+// a trace follows a message through every block that it affects.
+//
+// each block reports what it did with a traced message to its Tracer as a
+// Hop. blocks without a Tracer pass traces along without reporting them.
+
+type TraceID uint64
+
+// A Tracer decides which messages are traced and records their journeys.
+type Tracer interface {
+	// Start is called for every message that enters the pattern. It
+	// returns the id of a new trace if the message should be traced.
+	Start() (TraceID, bool)
+	// Record records a block's handling of a traced message.
+	Record(Hop)
+}
+
+// A Hop is a block's handling of a traced message.
+type Hop struct {
+	Trace    TraceID   `json:"trace"`
+	Block    int       `json:"block"`
+	Inputs   []string  `json:"inputs"`  // the inputs the traced message arrived on
+	Outputs  []string  `json:"outputs"` // the outputs the block emitted on
+	Received time.Time `json:"received"`
+	Kernel   float64   `json:"kernel"` // kernel execution time in seconds
+}
+
+// traced wraps a message that belongs to one or more traces.
+type traced struct {
+	traces []TraceID
+	m      Message
+}
+
+// Untrace returns a message without any trace it belongs to. Anything that
+// reads from a block's output other than another block should untrace the
+// messages it receives.
+func Untrace(m Message) Message {
+	if t, ok := m.(*traced); ok {
+		return t.m
+	}
+	return m
+}
+
+// blockTrace holds the traces of the current crank of a block.
+type blockTrace struct {
+	traces   []TraceID
+	inputs   []string
+	outputs  []string
+	received time.Time
+	kernel   time.Duration
+}
+
+// SetTracer sets the Tracer that the block reports traced messages to. It
+// can be set to nil.
+func (b *Block) SetTracer(t Tracer) {
+	b.routing.InterruptChan <- func() bool {
+		b.tracer = t
+		return true
+	}
+}
+
+// untrace unwraps a message received on an input, adding any traces it
+// belongs to to the current crank.
+func (b *Block) untrace(input string, m Message) Message {
+	t, ok := m.(*traced)
+	if !ok {
+		return m
+	}
+	if len(b.trace.traces) == 0 {
+		b.trace.received = time.Now()
+	}
+	b.trace.inputs = append(b.trace.inputs, input)
+outer:
+	for _, id := range t.traces {
+		for _, existing := range b.trace.traces {
+			if id == existing {
+				continue outer
+			}
+		}
+		b.trace.traces = append(b.trace.traces, id)
+	}
+	return t.m
+}
+
+// startTrace starts a trace for a message entering the pattern through an
+// ingress block.
+func (b *Block) startTrace() {
+	if b.tracer == nil || len(b.trace.traces) > 0 {
+		return
+	}
+	if b.sourceType != STREAM && b.sourceType != SERVER {
+		return
+	}
+	id, ok := b.tracer.Start()
+	if !ok {
+		return
+	}
+	b.trace.traces = append(b.trace.traces, id)
+	b.trace.received = time.Now()
+}
+
+// wrap wraps a message emitted on an output with the traces of the current
+// crank.
+func (b *Block) wrap(output string, m Message) Message {
+	if len(b.trace.traces) == 0 {
+		return m
+	}
+	// an output can be wrapped more than once if its broadcast is
+	// interrupted
+	if n := len(b.trace.outputs); n == 0 || b.trace.outputs[n-1] != output {
+		b.trace.outputs = append(b.trace.outputs, output)
+	}
+	return &traced{b.trace.traces, m}
+}
+
+// recordTrace reports the current crank to the block's Tracer.
+func (b *Block) recordTrace() {
+	if b.tracer == nil {
+		return
+	}
+	for _, id := range b.trace.traces {
+		b.tracer.Record(Hop{
+			Trace:    id,
+			Block:    b.id,
+			Inputs:   b.trace.inputs,
+			Outputs:  b.trace.outputs,
+			Received: b.trace.received,
+			Kernel:   b.trace.kernel.Seconds(),
+		})
+	}
+}
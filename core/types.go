@@ -16,6 +16,7 @@ const (
 	VALUE_PRIMITIVE
 	PRIORITY
 	SERVER
+	DEAD_LETTER
 )
 
 // JSONType defines the possible types that variables in core can take
@@ -90,6 +91,8 @@ func (s *SourceType) UnmarshalJSON(data []byte) error {
 		*s = SourceType(PRIORITY)
 	case `"server"`:
 		*s = SourceType(SERVER)
+	case `"dead_letter"`:
+		*s = SourceType(DEAD_LETTER)
 	default:
 		return errors.New("Error unmarshalling source type")
 	}
@@ -112,6 +115,8 @@ func (s SourceType) MarshalJSON() ([]byte, error) {
 		return []byte(`"value"`), nil
 	case PRIORITY:
 		return []byte(`"priority-queue"`), nil
+	case DEAD_LETTER:
+		return []byte(`"dead_letter"`), nil
 	}
 	return nil, errors.New("Unknown source type")
 }
@@ -140,6 +145,10 @@ type Spec struct {
 	Outputs []Pin
 	Source  SourceType
 	Kernel  Kernel
+	Preempt bool // messages that arrive while the kernel runs interrupt it
+	// Cleanup releases what the kernel holds in its internal state when the
+	// block stops or is reset
+	Cleanup func(internal MessageMap)
 }
 
 // Input is an inbound route to a block. A Input holds the channel that allows Messages
@@ -237,6 +246,20 @@ type Block struct {
 	Monitor    chan MonitorMessage
 	lastCrank  time.Time
 	done       chan struct{}
+	typeCheck  bool
+	id         int
+	paused     bool
+	stats      blockStats
+	tracer     Tracer
+	trace      blockTrace
+	taps       map[ManifestPair]chan Message
+	inputs     inputSync
+	preempt    bool
+	pending    Interrupt
+	cleanup    func(MessageMap)
+	replays    [][]Message   // inputs queued by Replay
+	rejected   *ErrorMessage // an input that failed type checking, waiting to be emitted
+	rejecting  bool          // true while a crank emits a rejected input
 	//blockageTimer *time.Timer
 }
 
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// window blocks aggregate the messages they receive over a window of either
+// a number of messages or a length of time. tumbling windows emit once per
+// window and then start again empty. sliding windows emit on every message,
+// aggregating the messages still inside the window.
+//
+// the aggregate is one of sum, mean, min, max, count, distinct, or a
+// percentile written as p followed by the percentile, like p50 or p99.9. all
+// but count and distinct require numbers.
+
+type windowEntry struct {
+	t time.Time
+	m Message
+}
+
+// window is the state a window block keeps in its internal MessageMap.
+type window struct {
+	entries []windowEntry
+	start   time.Time
+}
+
+func getWindow(internal MessageMap) *window {
+	w, ok := internal[0].(*window)
+	if !ok {
+		w = &window{}
+		internal[0] = w
+	}
+	return w
+}
+
+// aggregate returns the named aggregate of messages.
+func aggregate(name string, entries []windowEntry) (Message, error) {
+	switch name {
+	case "count":
+		return float64(len(entries)), nil
+	case "distinct":
+		seen := make(map[string]struct{})
+		for _, e := range entries {
+			k, err := json.Marshal(e.m)
+			if err != nil {
+				return nil, err
+			}
+			seen[string(k)] = struct{}{}
+		}
+		return float64(len(seen)), nil
+	}
+
+	// a window can hold messages that aren't numbers if its aggregate has
+	// changed
+	values := make([]float64, len(entries))
+	for i, e := range entries {
+		v, ok := e.m.(float64)
+		if !ok {
+			return nil, NewError(name + " requires numbers")
+		}
+		values[i] = v
+	}
+	if len(values) == 0 {
+		return nil, NewError("cannot aggregate an empty window")
+	}
+
+	switch name {
+	case "sum", "mean":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if name == "mean" {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	case "min":
+		min := values[0]
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min, nil
+	case "max":
+		max := values[0]
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max, nil
+	}
+
+	p, _ := percentile(name)
+	sort.Float64s(values)
+	// nearest rank
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1], nil
+}
+
+// percentile parses an aggregate like p95.
+func percentile(name string) (float64, bool) {
+	if !strings.HasPrefix(name, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(name[1:], 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+// checkAggregate returns an error if the aggregate is unknown, or if it can't
+// aggregate m.
+func checkAggregate(name Message, m Message) error {
+	n, ok := name.(string)
+	if !ok {
+		return NewError("aggregate must be a string")
+	}
+	switch n {
+	case "count", "distinct":
+		return nil
+	case "sum", "mean", "min", "max":
+	default:
+		if _, ok := percentile(n); !ok {
+			return NewError("unknown aggregate " + n)
+		}
+	}
+	if _, ok := m.(float64); !ok {
+		return NewError(n + " requires numbers")
+	}
+	return nil
+}
+
+// maxWindowSize is the largest size that can be converted to an int. NaN and
+// infinite sizes fail the comparisons in windowSize.
+const maxWindowSize = float64(int(^uint(0) >> 1))
+
+func windowSize(m Message) (int, error) {
+	size, ok := m.(float64)
+	if !ok || !(size >= 1 && size < maxWindowSize) || size != math.Floor(size) {
+		return 0, NewError("window size must be a positive whole number")
+	}
+	return int(size), nil
+}
+
+func windowDuration(m Message) (time.Duration, error) {
+	s, ok := m.(string)
+	if !ok {
+		return 0, NewError("window duration must be a string")
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, NewError("window duration must be positive")
+	}
+	return d, nil
+}
+
+// CountWindow emits the aggregate of every size messages.
+func CountWindow() Spec {
+	return Spec{
+		Name:    "countWindow",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"size", NUMBER}, Pin{"aggregate", STRING}},
+		Outputs: []Pin{Pin{"out", NUMBER}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			size, err := windowSize(in[1])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			if err := checkAggregate(in[2], in[0]); err != nil {
+				out[0] = err
+				return nil
+			}
+			w := getWindow(internal)
+			w.entries = append(w.entries, windowEntry{m: in[0]})
+			if len(w.entries) < size {
+				return nil
+			}
+			out[0], err = aggregate(in[2].(string), w.entries)
+			if err != nil {
+				out[0] = err
+			}
+			w.entries = nil
+			return nil
+		},
+	}
+}
+
+// SlidingCountWindow emits the aggregate of the last size messages on every
+// message.
+func SlidingCountWindow() Spec {
+	return Spec{
+		Name:    "slidingCountWindow",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"size", NUMBER}, Pin{"aggregate", STRING}},
+		Outputs: []Pin{Pin{"out", NUMBER}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			size, err := windowSize(in[1])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			if err := checkAggregate(in[2], in[0]); err != nil {
+				out[0] = err
+				return nil
+			}
+			w := getWindow(internal)
+			w.entries = append(w.entries, windowEntry{m: in[0]})
+			if len(w.entries) > size {
+				w.entries = w.entries[len(w.entries)-size:]
+			}
+			out[0], err = aggregate(in[2].(string), w.entries)
+			if err != nil {
+				out[0] = err
+			}
+			return nil
+		},
+	}
+}
+
+// windowed replaces a message on a time window's input once it has been added
+// to the window, so that the kernel doesn't add it again when it is run again
+// after an interrupt.
+type windowed struct{}
+
+// TimeWindow emits the aggregate of the messages received during each window
+// of duration. A window starts with the first message it receives, and is
+// emitted as soon as it ends.
+func TimeWindow() Spec {
+	return Spec{
+		Name:    "timeWindow",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"duration", STRING}, Pin{"aggregate", STRING}},
+		Outputs: []Pin{Pin{"out", NUMBER}},
+		Preempt: true,
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			d, err := windowDuration(in[1])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			name := in[2].(string)
+			w := getWindow(internal)
+			if _, ok := in[0].(windowed); !ok {
+				if err := checkAggregate(in[2], in[0]); err != nil {
+					// a message that can't be aggregated is reported
+					// along with the window that is already open
+					out[ErrorRoute] = err
+					if len(w.entries) == 0 {
+						return nil
+					}
+				} else {
+					now := time.Now()
+					if len(w.entries) == 0 {
+						w.start = now
+					}
+					w.entries = append(w.entries, windowEntry{now, in[0]})
+					in[0] = windowed{}
+				}
+			}
+
+			// messages that arrive while the window is open interrupt the
+			// wait, and the kernel runs again to add them
+			timer := time.NewTimer(w.start.Add(d).Sub(time.Now()))
+			select {
+			case <-timer.C:
+				out[0], err = aggregate(name, w.entries)
+				if err != nil {
+					out[0] = err
+				}
+				w.entries = nil
+				return nil
+			case f := <-i:
+				timer.Stop()
+				return f
+			}
+		},
+	}
+}
+
+// SlidingTimeWindow emits the aggregate of the messages received within the
+// last duration on every message.
+func SlidingTimeWindow() Spec {
+	return Spec{
+		Name:    "slidingTimeWindow",
+		Inputs:  []Pin{Pin{"in", ANY}, Pin{"duration", STRING}, Pin{"aggregate", STRING}},
+		Outputs: []Pin{Pin{"out", NUMBER}},
+		Kernel: func(in, out, internal MessageMap, s Source, i chan Interrupt) Interrupt {
+			d, err := windowDuration(in[1])
+			if err != nil {
+				out[0] = err
+				return nil
+			}
+			if err := checkAggregate(in[2], in[0]); err != nil {
+				out[0] = err
+				return nil
+			}
+			now := time.Now()
+			w := getWindow(internal)
+			w.entries = append(w.entries, windowEntry{now, in[0]})
+			for len(w.entries) > 0 && now.Sub(w.entries[0].t) > d {
+				w.entries = w.entries[1:]
+			}
+			out[0], err = aggregate(in[2].(string), w.entries)
+			if err != nil {
+				out[0] = err
+			}
+			return nil
+		},
+	}
+}
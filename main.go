@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/nytlabs/st-core/server"
@@ -13,6 +15,12 @@ import (
 
 func main() {
 
+	// st-core run <pattern.json> runs a pattern without the web interface
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		run(os.Args[2:])
+		return
+	}
+
 	// Unpack settings file, or create a new one if necessary
 	var settings server.Settings
 
@@ -27,6 +35,7 @@ func main() {
 			// make a fresh settings file
 			log.Println("creating new settings file at", fname)
 			newSettings := server.NewSettings()
+			newSettings.PatternFile = dir + "/.st.pattern.json"
 			d, err = json.Marshal(newSettings)
 			err = ioutil.WriteFile(fname, d, 0644)
 			if err != nil {
@@ -36,6 +45,9 @@ func main() {
 			log.Fatal(err)
 		}
 	}
+	// by default, persist the running pattern alongside the settings file. a
+	// PatternFile set to "" in the settings file disables persistence.
+	settings.PatternFile = dir + "/.st.pattern.json"
 	err = json.Unmarshal(d, &settings)
 	if err != nil {
 		log.Fatal(err)
@@ -46,9 +58,20 @@ func main() {
 
 	http.Handle("/", r)
 
-	log.Println("serving on 7071")
-	err = http.ListenAndServe(":7071", nil)
+	go func() {
+		log.Println("serving on 7071")
+		err := http.ListenAndServe(":7071", nil)
+		if err != nil {
+			log.Panicf(err.Error())
+		}
+	}()
+
+	// stop the pattern cleanly when we are asked to quit
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Println("shutting down on", <-sig)
+	err = s.Shutdown()
 	if err != nil {
-		log.Panicf(err.Error())
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nytlabs/st-core/server"
+)
+
+// run loads an exported pattern and runs it without the web interface until
+// the process is interrupted or terminated.
+func run(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	drain := flags.String("drain", server.NewSettings().DrainTimeout, "how long messages are given to drain on shutdown")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: st-core run [-drain 5s] <pattern.json>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	settings := server.NewSettings()
+	settings.LogErrors = true
+	settings.DrainTimeout = *drain
+
+	s := server.NewServer(settings)
+	err := s.LoadPattern(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	log.Println("running", path)
+	log.Println("stopping on", <-sig)
+	err = s.Shutdown()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
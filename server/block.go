@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nytlabs/st-core/core"
@@ -17,10 +18,20 @@ type Position struct {
 }
 
 type ProtoBlock struct {
-	Label    string   `json:"label"`
-	Parent   int      `json:"parent"`
-	Type     string   `json:"type"`
-	Position Position `json:"position"`
+	Label     string        `json:"label"`
+	Parent    int           `json:"parent"`
+	Type      string        `json:"type"`
+	Position  Position      `json:"position"`
+	TypeCheck bool          `json:"typecheck"`
+	Sync      core.SyncMode `json:"sync,omitempty"`
+	Window    string        `json:"window,omitempty"`
+}
+
+// ProtoSync sets when a block runs its kernel. Window is a duration, like
+// "100ms", and is only used by the "window" sync mode.
+type ProtoSync struct {
+	Sync   core.SyncMode `json:"sync"`
+	Window string        `json:"window,omitempty"`
 }
 
 type BlockLedger struct {
@@ -34,8 +45,13 @@ type BlockLedger struct {
 	Outputs      []core.Output   `json:"outputs"`
 	Source       core.SourceType `json:"source"`
 	Position     Position        `json:"position"`
+	TypeCheck    bool            `json:"typecheck"`
+	Sync         core.SyncMode   `json:"sync,omitempty"`
+	Window       string          `json:"window,omitempty"`
+	State        string          `json:"state"`
 	MonitorQuery chan struct{}   `json:"-"`
 	MonitorQuit  chan struct{}   `json:"-"`
+	composite    *composite
 }
 
 func (bl *BlockLedger) GetID() int {
@@ -50,6 +66,32 @@ func (bl *BlockLedger) SetParent(group *Group) {
 	bl.Parent = group
 }
 
+// input returns the core block and route that messages sent to the ledger's
+// input are delivered to. For composite blocks this is a block inside the
+// composite.
+func (bl *BlockLedger) input(route int) (*core.Block, core.RouteIndex, error) {
+	if bl.composite != nil {
+		return bl.composite.input(route)
+	}
+	return bl.Block, core.RouteIndex(route), nil
+}
+
+// output returns the core block and route that emit the ledger's output.
+func (bl *BlockLedger) output(route int) (*core.Block, core.RouteIndex, error) {
+	if bl.composite != nil {
+		return bl.composite.output(route)
+	}
+	return bl.Block, core.RouteIndex(route), nil
+}
+
+// cores returns every core block that the ledger runs.
+func (bl *BlockLedger) cores() []*core.Block {
+	if bl.composite != nil {
+		return bl.composite.cores()
+	}
+	return []*core.Block{bl.Block}
+}
+
 func (s *Server) ListBlocks() []BlockLedger {
 	blocks := []BlockLedger{}
 	for _, b := range s.blocks {
@@ -132,11 +174,35 @@ func (s *Server) BlockModifyPositionHandler(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Server) CreateBlock(p ProtoBlock) (*BlockLedger, error) {
+	if m, ok := s.macros[p.Type]; ok {
+		// the inputs of a composite are spread across the blocks inside it
+		if p.Sync != core.SYNC_ALL {
+			return nil, errors.New("cannot set the sync mode of a composite block")
+		}
+		b, err := s.createComposite(p, m)
+		if err != nil {
+			return nil, err
+		}
+		if p.TypeCheck {
+			err = s.ModifyBlockTypeCheck(b.Id, true)
+			if err != nil {
+				s.DeleteBlock(b.Id)
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
 	blockSpec, ok := s.library[p.Type]
 	if !ok {
 		return nil, errors.New("spec " + p.Type + " not found")
 	}
 
+	window, err := syncWindow(ProtoSync{p.Sync, p.Window})
+	if err != nil {
+		return nil, err
+	}
+
 	block := core.NewBlock(blockSpec)
 
 	m := &BlockLedger{
@@ -145,6 +211,8 @@ func (s *Server) CreateBlock(p ProtoBlock) (*BlockLedger, error) {
 		Type:         p.Type,
 		Block:        block,
 		Source:       blockSpec.Source,
+		TypeCheck:    p.TypeCheck,
+		State:        RUNNING,
 		Id:           s.GetNextID(),
 		MonitorQuit:  make(chan struct{}),
 		MonitorQuery: make(chan struct{}),
@@ -154,22 +222,33 @@ func (s *Server) CreateBlock(p ProtoBlock) (*BlockLedger, error) {
 		return nil, errors.New("invalid group, could not create block")
 	}
 
+	// the monitor has to be running before any interrupts are sent to the
+	// block, otherwise the block can stall reporting its state.
+	go s.MonitorMux(m.Id, block.Monitor, m.MonitorQuery, m.MonitorQuit)
+
 	go block.Serve()
+	block.SetID(m.Id)
+	block.SetTracer(s.tracer)
+	if p.TypeCheck {
+		block.SetTypeCheck(true)
+	}
+	if p.Sync != core.SYNC_ALL {
+		block.SetSync(p.Sync, window)
+		m.Sync = p.Sync
+		m.Window = p.Window
+	}
 	m.Inputs = block.GetInputs()
 	m.Outputs = block.GetOutputs()
 	s.blocks[m.Id] = m
 
 	s.websocketBroadcast(Update{Action: CREATE, Type: BLOCK, Data: wsBlock{*m}})
 
-	err := s.AddChildToGroup(p.Parent, m)
+	err = s.AddChildToGroup(p.Parent, m)
 	if err != nil {
 		return nil, err
 
 	}
 
-	// begin monitor
-	go s.MonitorMux(m.Id, block.Monitor, m.MonitorQuery, m.MonitorQuit)
-
 	return m, nil
 }
 
@@ -276,7 +355,11 @@ func (s *Server) DeleteBlock(id int) error {
 	s.DetachChild(b)
 
 	// stop and delete the block
-	b.Block.Stop()
+	if b.composite != nil {
+		b.composite.stop()
+	} else {
+		b.Block.Stop()
+	}
 
 	// close the monitor chan so that we quit the monitor routine.
 	// close(b.Block.Monitor)
@@ -371,7 +454,12 @@ func (s *Server) ModifyBlockRoute(id int, route int, v *core.InputValue) error {
 		value = v
 	}
 
-	err := b.Block.SetInput(core.RouteIndex(route), value)
+	block, r, err := b.input(route)
+	if err != nil {
+		return err
+	}
+
+	err = block.SetInput(r, value)
 	if err != nil {
 		return err
 	}
@@ -381,3 +469,141 @@ func (s *Server) ModifyBlockRoute(id int, route int, v *core.InputValue) error {
 	s.websocketBroadcast(Update{Action: UPDATE, Type: ROUTE, Data: wsRouteModify{ConnectionNode{id, route}, value}})
 	return nil
 }
+
+func (s *Server) BlockModifyTypeCheckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read request body"})
+		return
+	}
+
+	var on bool
+	err = json.Unmarshal(body, &on)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not unmarshal value"})
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = s.ModifyBlockTypeCheck(id, on)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModifyBlockTypeCheck enables or disables checking the block's messages
+// against the types of its pins.
+func (s *Server) ModifyBlockTypeCheck(id int, on bool) error {
+	b, ok := s.blocks[id]
+	if !ok {
+		return errors.New("could not find block")
+	}
+
+	for _, block := range b.cores() {
+		block.SetTypeCheck(on)
+	}
+	b.TypeCheck = on
+
+	s.websocketBroadcast(Update{Action: UPDATE, Type: BLOCK, Data: wsBlock{wsTypeCheck{wsId{id}, on}}})
+	return nil
+}
+
+func (s *Server) BlockModifySyncHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read request body"})
+		return
+	}
+
+	var p ProtoSync
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = s.ModifyBlockSync(id, p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncWindow parses the window of a sync mode.
+func syncWindow(p ProtoSync) (time.Duration, error) {
+	if p.Sync != core.SYNC_WINDOW {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(p.Window)
+	if err != nil {
+		return 0, err
+	}
+	if window <= 0 {
+		return 0, errors.New("sync window must be positive")
+	}
+	return window, nil
+}
+
+// ModifyBlockSync sets when the block runs its kernel: once every input has
+// a message, whenever any input has a message, or once every input has a
+// message or the window has passed.
+func (s *Server) ModifyBlockSync(id int, p ProtoSync) error {
+	b, ok := s.blocks[id]
+	if !ok {
+		return errors.New("could not find block")
+	}
+
+	// the inputs of a composite are spread across the blocks inside it
+	if b.composite != nil {
+		return errors.New("cannot set the sync mode of a composite block")
+	}
+
+	window, err := syncWindow(p)
+	if err != nil {
+		return err
+	}
+
+	err = b.Block.SetSync(p.Sync, window)
+	if err != nil {
+		return err
+	}
+
+	b.Sync = p.Sync
+	b.Window = ""
+	if p.Sync == core.SYNC_WINDOW {
+		b.Window = p.Window
+	}
+
+	s.websocketBroadcast(Update{Action: UPDATE, Type: BLOCK, Data: wsBlock{wsSync{wsId{id}, b.Sync, b.Window}}})
+	return nil
+}
@@ -17,20 +17,44 @@ type ConnectionNode struct {
 }
 
 type ConnectionLedger struct {
-	Source ConnectionNode `json:"from"`
-	Target ConnectionNode `json:"to"`
-	Id     int            `json:"id"`
+	Source   ConnectionNode      `json:"from"`
+	Target   ConnectionNode      `json:"to"`
+	Id       int                 `json:"id"`
+	Buffer   int                 `json:"buffer,omitempty"`   // the number of messages queued on the connection. 0 for no buffer.
+	Overflow core.OverflowPolicy `json:"overflow,omitempty"` // what happens to messages sent to a full buffer
+	Depth    int                 `json:"depth"`              // the number of messages in the buffer
+	Dropped  uint64              `json:"dropped,omitempty"`  // the number of messages the buffer has dropped
+	buffer   *core.Buffer
 }
 
 type ProtoConnection struct {
-	Source ConnectionNode `json:"from"`
-	Target ConnectionNode `json:"to"`
+	Source   ConnectionNode      `json:"from"`
+	Target   ConnectionNode      `json:"to"`
+	Coerce   bool                `json:"coerce,omitempty"` // insert a conversion block if the pin types don't match
+	Buffer   int                 `json:"buffer,omitempty"`
+	Overflow core.OverflowPolicy `json:"overflow,omitempty"`
+}
+
+type ProtoBuffer struct {
+	Buffer   int                 `json:"buffer"`
+	Overflow core.OverflowPolicy `json:"overflow"`
+}
+
+// snapshot returns a copy of the connection with the current depth of its
+// buffer.
+func (c *ConnectionLedger) snapshot() ConnectionLedger {
+	nc := *c
+	if c.buffer != nil {
+		nc.Depth = c.buffer.Len()
+		nc.Dropped = c.buffer.Dropped()
+	}
+	return nc
 }
 
 func (s *Server) ListConnections() []ConnectionLedger {
 	connections := []ConnectionLedger{}
 	for _, c := range s.connections {
-		connections = append(connections, *c)
+		connections = append(connections, c.snapshot())
 	}
 	return connections
 }
@@ -85,21 +109,66 @@ func (s *Server) CreateConnection(newConn ProtoConnection) (*ConnectionLedger, e
 		return nil, errors.New("target block does not exist")
 	}
 
-	sourceRoute := core.RouteIndex(newConn.Source.Route)
-	targetRoute, err := target.Block.GetInput(core.RouteIndex(newConn.Target.Route))
+	if newConn.Source.Route < 0 || newConn.Source.Route >= len(source.Outputs) {
+		return nil, errors.New("output out of range")
+	}
+
+	if newConn.Target.Route < 0 || newConn.Target.Route >= len(target.Inputs) {
+		return nil, errors.New("input out of range")
+	}
+
+	if newConn.Buffer < 0 {
+		return nil, errors.New("buffer size cannot be negative")
+	}
+
+	from := source.Outputs[newConn.Source.Route].Type
+	to := target.Inputs[newConn.Target.Route].Type
+	if !core.Compatible(from, to) {
+		if !newConn.Coerce {
+			return nil, errors.New("cannot connect " + from.String() + " output to " + to.String() + " input")
+		}
+		return s.coerceConnection(newConn, source, target, from, to)
+	}
+
+	sourceBlock, sourceRoute, err := source.output(newConn.Source.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	targetBlock, targetRoute, err := target.input(newConn.Target.Route)
 	if err != nil {
 		return nil, err
 	}
 
-	err = source.Block.Connect(sourceRoute, targetRoute.C)
+	input, err := targetBlock.GetInput(targetRoute)
 	if err != nil {
 		return nil, err
 	}
 
 	conn := &ConnectionLedger{
-		Source: newConn.Source,
-		Target: newConn.Target,
-		Id:     s.GetNextID(),
+		Source:   newConn.Source,
+		Target:   newConn.Target,
+		Id:       s.GetNextID(),
+		Buffer:   newConn.Buffer,
+		Overflow: newConn.Overflow,
+	}
+
+	c := input.C
+	if conn.Buffer > 0 {
+		conn.buffer, err = core.NewBuffer(input.C, conn.Buffer, conn.Overflow)
+		if err != nil {
+			return nil, err
+		}
+		go conn.buffer.Serve()
+		c = conn.buffer.In
+	}
+
+	err = sourceBlock.Connect(sourceRoute, c)
+	if err != nil {
+		if conn.buffer != nil {
+			conn.buffer.Stop()
+		}
+		return nil, err
 	}
 
 	s.ResetGraph(conn)
@@ -110,6 +179,223 @@ func (s *Server) CreateConnection(newConn ProtoConnection) (*ConnectionLedger, e
 	return conn, nil
 }
 
+// coerceConnection connects source to target through a new block that converts
+// messages of type from into messages of type to. The returned connection is
+// the one that delivers converted messages to target.
+func (s *Server) coerceConnection(newConn ProtoConnection, source, target *BlockLedger, from, to core.JSONType) (*ConnectionLedger, error) {
+	name, ok := core.Coercion(from, to)
+	if !ok {
+		return nil, errors.New("cannot coerce " + from.String() + " output to " + to.String() + " input")
+	}
+
+	parent := 0
+	if target.Parent != nil {
+		parent = target.Parent.Id
+	}
+
+	b, err := s.CreateBlock(ProtoBlock{
+		Type:   name,
+		Parent: parent,
+		Position: Position{
+			X: (source.Position.X + target.Position.X) / 2,
+			Y: (source.Position.Y + target.Position.Y) / 2,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: newConn.Source,
+		Target: ConnectionNode{b.Id, 0},
+	})
+	if err != nil {
+		s.DeleteBlock(b.Id)
+		return nil, err
+	}
+
+	conn, err := s.CreateConnection(ProtoConnection{
+		Source:   ConnectionNode{b.Id, 0},
+		Target:   newConn.Target,
+		Buffer:   newConn.Buffer,
+		Overflow: newConn.Overflow,
+	})
+	if err != nil {
+		s.DeleteBlock(b.Id)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// inputChan returns the channel of the input that a connection delivers to.
+func (s *Server) inputChan(c *ConnectionLedger, target *BlockLedger) (core.Connection, error) {
+	targetBlock, targetRoute, err := target.input(c.Target.Route)
+	if err != nil {
+		return nil, err
+	}
+	route, err := targetBlock.GetInput(targetRoute)
+	if err != nil {
+		return nil, err
+	}
+	return route.C, nil
+}
+
+// connectionChan returns the channel that the source of a connection sends
+// on: the connection's buffer if it has one, otherwise the target's input.
+func (s *Server) connectionChan(c *ConnectionLedger, target *BlockLedger) (core.Connection, error) {
+	if c.buffer != nil {
+		return c.buffer.In, nil
+	}
+	return s.inputChan(c, target)
+}
+
+// flushBuffers empties the buffers of every connection whose target is in ids,
+// including the connections inside composites.
+func (s *Server) flushBuffers(ids map[int]struct{}) {
+	for _, c := range s.connections {
+		if _, ok := ids[c.Target.Id]; ok && c.buffer != nil {
+			c.buffer.Flush()
+		}
+	}
+	for id := range ids {
+		if b, ok := s.blocks[id]; ok && b.composite != nil {
+			for _, buffer := range b.composite.buffers {
+				buffer.Flush()
+			}
+		}
+	}
+}
+
+// ModifyConnectionBuffer changes the size and overflow policy of a
+// connection's buffer. A size of 0 removes the buffer, along with any
+// messages in it.
+func (s *Server) ModifyConnectionBuffer(id int, p ProtoBuffer) (*ConnectionLedger, error) {
+	c, ok := s.connections[id]
+	if !ok {
+		return nil, errors.New("could not find connection")
+	}
+
+	if p.Buffer < 0 {
+		return nil, errors.New("buffer size cannot be negative")
+	}
+
+	// an existing buffer is resized in place so that it keeps its messages
+	if c.buffer != nil && p.Buffer > 0 {
+		err := c.buffer.Resize(p.Buffer, p.Overflow)
+		if err != nil {
+			return nil, err
+		}
+		c.Buffer = p.Buffer
+		c.Overflow = p.Overflow
+		s.websocketBroadcast(Update{Action: UPDATE, Type: CONNECTION, Data: wsConnection{c.snapshot()}})
+		return c, nil
+	}
+
+	source, ok := s.blocks[c.Source.Id]
+	if !ok {
+		return nil, errors.New("could not find source block")
+	}
+
+	target, ok := s.blocks[c.Target.Id]
+	if !ok {
+		return nil, errors.New("could not find target block")
+	}
+
+	sourceBlock, sourceRoute, err := source.output(c.Source.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := s.inputChan(c, target)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := s.connectionChan(c, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer *core.Buffer
+	route := input
+	if p.Buffer > 0 {
+		buffer, err = core.NewBuffer(input, p.Buffer, p.Overflow)
+		if err != nil {
+			return nil, err
+		}
+		go buffer.Serve()
+		route = buffer.In
+	}
+
+	err = sourceBlock.Disconnect(sourceRoute, old)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sourceBlock.Connect(sourceRoute, route)
+	if err != nil {
+		return nil, err
+	}
+
+	// disconnecting removes any tap on the connection, so the tap has to
+	// be put back on the new channel
+	if tap, ok := s.taps[id]; ok {
+		err = sourceBlock.Tap(sourceRoute, route, tap.c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.buffer != nil {
+		c.buffer.Stop()
+	}
+
+	c.buffer = buffer
+	c.Buffer = p.Buffer
+	c.Overflow = p.Overflow
+
+	s.websocketBroadcast(Update{Action: UPDATE, Type: CONNECTION, Data: wsConnection{c.snapshot()}})
+	return c, nil
+}
+
+func (s *Server) ConnectionModifyBufferHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read request body"})
+		return
+	}
+
+	var p ProtoBuffer
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read JSON"})
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.ModifyConnectionBuffer(id, p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, c.snapshot())
+}
+
 /*
 ResetGraph stops/resets/starts the entire connected subgraph related to
 connection Conn. It is a general approach that probably touches a lot more
@@ -171,17 +457,25 @@ func (s *Server) ResetGraph(conn *ConnectionLedger) {
 
 	for k, _ := range found {
 		log.Println("tidy: stopping id", k)
-		s.blocks[k].Block.Stop()
+		for _, b := range s.blocks[k].cores() {
+			b.Stop()
+		}
 	}
 
+	s.flushBuffers(found)
+
 	for k, _ := range found {
 		log.Println("tidy: resetting id", k)
-		s.blocks[k].Block.Reset()
+		for _, b := range s.blocks[k].cores() {
+			b.Reset()
+		}
 	}
 
 	for k, _ := range found {
 		log.Println("tidy: starting id", k)
-		go s.blocks[k].Block.Serve()
+		for _, b := range s.blocks[k].cores() {
+			go b.Serve()
+		}
 	}
 }
 
@@ -203,7 +497,7 @@ func (s *Server) ConnectionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	writeJSON(w, conn)
+	writeJSON(w, conn.snapshot())
 }
 
 func (s *Server) ConnectionModifyCoordinates(w http.ResponseWriter, r *http.Request) {
@@ -225,16 +519,32 @@ func (s *Server) DeleteConnection(id int) error {
 		return errors.New("could not find target block")
 	}
 
-	route, err := target.Block.GetInput(core.RouteIndex(c.Target.Route))
+	if _, ok := s.taps[id]; ok {
+		err := s.DeleteTap(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	sourceBlock, sourceRoute, err := source.output(c.Source.Route)
 	if err != nil {
 		return err
 	}
 
-	err = source.Block.Disconnect(core.RouteIndex(c.Source.Route), route.C)
+	route, err := s.connectionChan(c, target)
 	if err != nil {
 		return err
 	}
 
+	err = sourceBlock.Disconnect(sourceRoute, route)
+	if err != nil {
+		return err
+	}
+
+	if c.buffer != nil {
+		c.buffer.Stop()
+	}
+
 	delete(s.connections, id)
 
 	s.ResetGraph(c)
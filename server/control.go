@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// the blocks of a group can be started, paused, stopped and reset as a whole.
+// a paused block keeps whatever messages it was working on and carries on
+// from there when it is started again. a stopped block has its state cleared,
+// so it starts again from scratch. both paused and stopped blocks continue to
+// accept changes to their routes and connections.
+
+const (
+	RUNNING = "running"
+	PAUSED  = "paused"
+	STOPPED = "stopped"
+)
+
+// descendants returns every block and group below the group, including the
+// group itself.
+func (s *Server) descendants(id int) ([]*BlockLedger, []*Group, error) {
+	g, ok := s.groups[id]
+	if !ok {
+		return nil, nil, errors.New("could not find group")
+	}
+
+	blocks := []*BlockLedger{}
+	groups := []*Group{g}
+	for _, c := range g.Children {
+		if b, ok := s.blocks[c]; ok {
+			blocks = append(blocks, b)
+		}
+		if _, ok := s.groups[c]; ok {
+			cb, cg, err := s.descendants(c)
+			if err != nil {
+				return nil, nil, err
+			}
+			blocks = append(blocks, cb...)
+			groups = append(groups, cg...)
+		}
+	}
+	return blocks, groups, nil
+}
+
+// setBlockState pauses or resumes the block to match state.
+func (s *Server) setBlockState(b *BlockLedger, state string) {
+	if b.State == state {
+		return
+	}
+	for _, block := range b.cores() {
+		if state == RUNNING {
+			block.Resume()
+		} else {
+			block.Pause()
+		}
+	}
+	b.State = state
+	s.websocketBroadcast(Update{Action: UPDATE, Type: BLOCK, Data: wsBlock{wsState{wsId{b.Id}, state}}})
+}
+
+// resetBlocks clears the state of every block in blocks, and of the buffers
+// on their inputs.
+func (s *Server) resetBlocks(blocks []*BlockLedger) {
+	ids := make(map[int]struct{})
+	for _, b := range blocks {
+		ids[b.Id] = struct{}{}
+		for _, block := range b.cores() {
+			block.Stop()
+		}
+	}
+	s.flushBuffers(ids)
+	for _, b := range blocks {
+		for _, block := range b.cores() {
+			block.Reset()
+		}
+	}
+	for _, b := range blocks {
+		for _, block := range b.cores() {
+			go block.Serve()
+		}
+	}
+}
+
+// ControlGroup sets every block under the group to state. Stopping a group
+// also clears the state of its blocks.
+func (s *Server) ControlGroup(id int, state string) error {
+	switch state {
+	case RUNNING, PAUSED, STOPPED:
+	default:
+		return errors.New("unknown state " + state)
+	}
+
+	blocks, groups, err := s.descendants(id)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range blocks {
+		s.setBlockState(b, state)
+	}
+
+	if state == STOPPED {
+		s.resetBlocks(blocks)
+	}
+
+	for _, g := range groups {
+		g.State = state
+		s.websocketBroadcast(Update{Action: UPDATE, Type: GROUP, Data: wsGroup{wsState{wsId{g.Id}, state}}})
+	}
+
+	return nil
+}
+
+// ResetGroup clears the state of every block under the group, leaving them
+// running, paused or stopped as they were.
+func (s *Server) ResetGroup(id int) error {
+	blocks, _, err := s.descendants(id)
+	if err != nil {
+		return err
+	}
+
+	s.resetBlocks(blocks)
+
+	s.websocketBroadcast(Update{Action: RESET, Type: GROUP, Data: wsGroup{wsId{id}}})
+	return nil
+}
+
+func (s *Server) groupControlHandler(w http.ResponseWriter, r *http.Request, f func(int) error) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = f(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) GroupStartHandler(w http.ResponseWriter, r *http.Request) {
+	s.groupControlHandler(w, r, func(id int) error {
+		return s.ControlGroup(id, RUNNING)
+	})
+}
+
+func (s *Server) GroupPauseHandler(w http.ResponseWriter, r *http.Request) {
+	s.groupControlHandler(w, r, func(id int) error {
+		return s.ControlGroup(id, PAUSED)
+	})
+}
+
+func (s *Server) GroupStopHandler(w http.ResponseWriter, r *http.Request) {
+	s.groupControlHandler(w, r, func(id int) error {
+		return s.ControlGroup(id, STOPPED)
+	})
+}
+
+func (s *Server) GroupResetHandler(w http.ResponseWriter, r *http.Request) {
+	s.groupControlHandler(w, r, s.ResetGroup)
+}
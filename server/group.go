@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,6 +23,7 @@ type Pattern struct {
 	Groups      []Group            `json:"groups"`
 	Sources     []SourceLedger     `json:"sources"`
 	Links       []LinkLedger       `json:"links"`
+	Macros      []Macro            `json:"macros,omitempty"`
 }
 
 type Node interface {
@@ -36,6 +38,7 @@ type Group struct {
 	Children []int    `json:"children"`
 	Parent   *Group   `json:"-"`
 	Position Position `json:"position"`
+	State    string   `json:"state,omitempty"`
 }
 
 type ProtoGroup struct {
@@ -458,6 +461,17 @@ func (s *Server) Export(id int) (*Pattern, error) {
 		}
 	}
 
+	// include the definitions of every macro, whether or not it has an
+	// instance, so that the pattern can be imported elsewhere
+	names := make([]string, 0, len(s.macros))
+	for name := range s.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.Macros = append(p.Macros, *s.macros[name])
+	}
+
 	return p, nil
 }
 
@@ -552,6 +566,17 @@ func (s *Server) ImportGroup(id int, p Pattern) ([]int, error) {
 		return nil, errors.New("could not attach to group: does not exist")
 	}
 
+	for i, _ := range p.Macros {
+		if _, ok := s.library[p.Macros[i].Name]; ok {
+			continue
+		}
+		m := p.Macros[i]
+		err := s.registerMacro(&m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for _, g := range p.Groups {
 		ng, err := s.CreateGroup(ProtoGroup{
 			Label:    g.Label,
@@ -562,6 +587,7 @@ func (s *Server) ImportGroup(id int, p Pattern) ([]int, error) {
 			return nil, err
 		}
 
+		ng.State = g.State
 		newIds[g.Id] = ng.Id
 
 		for _, c := range g.Children {
@@ -571,15 +597,24 @@ func (s *Server) ImportGroup(id int, p Pattern) ([]int, error) {
 
 	for _, b := range p.Blocks {
 		nb, err := s.CreateBlock(ProtoBlock{
-			Label:    b.Label,
-			Position: b.Position,
-			Type:     b.Type,
+			Label:     b.Label,
+			Position:  b.Position,
+			Type:      b.Type,
+			TypeCheck: b.TypeCheck,
+			Sync:      b.Sync,
+			Window:    b.Window,
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
+		// blocks that were paused or stopped when they were exported
+		// stay that way
+		if b.State == PAUSED || b.State == STOPPED {
+			s.setBlockState(nb, b.State)
+		}
+
 		newIds[b.Id] = nb.Id
 		newBlocks[nb.Id] = struct{}{}
 	}
@@ -602,8 +637,10 @@ func (s *Server) ImportGroup(id int, p Pattern) ([]int, error) {
 		c.Source.Id = newIds[c.Source.Id]
 		c.Target.Id = newIds[c.Target.Id]
 		nc, err := s.CreateConnection(ProtoConnection{
-			Source: c.Source,
-			Target: c.Target,
+			Source:   c.Source,
+			Target:   c.Target,
+			Buffer:   c.Buffer,
+			Overflow: c.Overflow,
 		})
 		if err != nil {
 			return nil, err
@@ -699,17 +736,23 @@ func (s *Server) ImportGroup(id int, p Pattern) ([]int, error) {
 	// more unified approach to block resetting.
 	for k, _ := range newBlocks {
 		log.Println("tidy: stopping id", k)
-		s.blocks[k].Block.Stop()
+		for _, b := range s.blocks[k].cores() {
+			b.Stop()
+		}
 	}
 
 	for k, _ := range newBlocks {
 		log.Println("tidy: resetting id", k)
-		s.blocks[k].Block.Reset()
+		for _, b := range s.blocks[k].cores() {
+			b.Reset()
+		}
 	}
 
 	for k, _ := range newBlocks {
 		log.Println("tidy: starting id", k)
-		go s.blocks[k].Block.Serve()
+		for _, b := range s.blocks[k].cores() {
+			go b.Serve()
+		}
 	}
 
 	// return a list of ids that have been added
@@ -39,6 +39,10 @@ func (s *Server) CreateLink(l ProtoLink) (*LinkLedger, error) {
 		return nil, errors.New("could not find source")
 	}
 
+	if b.composite != nil {
+		return nil, errors.New("cannot link a source to a macro")
+	}
+
 	link := &LinkLedger{}
 	link.Id = s.GetNextID()
 	link.Source.Id = l.Source.Id
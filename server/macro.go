@@ -0,0 +1,413 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nytlabs/st-core/core"
+)
+
+// A MacroPin exposes an input or output of a block inside a macro's pattern
+// as one of the macro's own pins.
+type MacroPin struct {
+	Id    int    `json:"id"`
+	Route int    `json:"route"`
+	Name  string `json:"name"`
+}
+
+// A Macro is a group that has been turned into a block type. Every instance
+// of a macro gets its own copy of the macro's pattern.
+type Macro struct {
+	Name    string     `json:"name"`
+	Group   int        `json:"group"`
+	Pattern Pattern    `json:"pattern"`
+	Inputs  []MacroPin `json:"inputs"`
+	Outputs []MacroPin `json:"outputs"`
+}
+
+type ProtoMacro struct {
+	Name    string     `json:"name"`
+	Inputs  []MacroPin `json:"inputs"`
+	Outputs []MacroPin `json:"outputs"`
+}
+
+// composite is a running instance of a macro.
+type composite struct {
+	blocks  map[int]*core.Block // keyed by the id of the block in the macro's pattern
+	sources map[int]core.Source
+	buffers []*core.Buffer // the buffers of the connections inside the macro
+	inputs  []MacroPin
+	outputs []MacroPin
+	monitor chan core.MonitorMessage
+	quit    chan struct{} // closed when the composite stops, to quit its monitor forwarders
+}
+
+func (c *composite) input(route int) (*core.Block, core.RouteIndex, error) {
+	if route < 0 || route >= len(c.inputs) {
+		return nil, 0, errors.New("input out of range")
+	}
+	pin := c.inputs[route]
+	return c.blocks[pin.Id], core.RouteIndex(pin.Route), nil
+}
+
+func (c *composite) output(route int) (*core.Block, core.RouteIndex, error) {
+	if route < 0 || route >= len(c.outputs) {
+		return nil, 0, errors.New("output out of range")
+	}
+	pin := c.outputs[route]
+	return c.blocks[pin.Id], core.RouteIndex(pin.Route), nil
+}
+
+func (c *composite) cores() []*core.Block {
+	blocks := []*core.Block{}
+	for _, b := range c.blocks {
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func (c *composite) stop() {
+	for _, b := range c.blocks {
+		b.Stop()
+	}
+	for _, source := range c.sources {
+		if si, ok := source.(core.Interface); ok {
+			si.Stop()
+		}
+	}
+	for _, buffer := range c.buffers {
+		buffer.Stop()
+	}
+	close(c.quit)
+}
+
+// forward passes the monitor messages of one of the composite's blocks on to
+// the composite's monitor until the composite stops.
+func (c *composite) forward(monitor chan core.MonitorMessage) {
+	for {
+		select {
+		case mm := <-monitor:
+			select {
+			case c.monitor <- mm:
+			case <-c.quit:
+				return
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// pinSpec returns the Pin of the block in the pattern that is referred to by a
+// MacroPin.
+func (s *Server) pinSpec(p Pattern, pin MacroPin, output bool) (core.Pin, error) {
+	for _, b := range p.Blocks {
+		if b.Id != pin.Id {
+			continue
+		}
+		spec, ok := s.library[b.Type]
+		if !ok {
+			return core.Pin{}, errors.New("spec " + b.Type + " not found")
+		}
+		pins := spec.Inputs
+		if output {
+			pins = make([]core.Pin, len(spec.Outputs), len(spec.Outputs)+1)
+			copy(pins, spec.Outputs)
+			pins = append(pins, core.ErrorPin)
+		}
+		if pin.Route < 0 || pin.Route >= len(pins) {
+			return core.Pin{}, errors.New("pin out of range on block " + strconv.Itoa(pin.Id))
+		}
+		p := pins[pin.Route]
+		if pin.Name != "" {
+			p.Name = pin.Name
+		}
+		return p, nil
+	}
+	return core.Pin{}, errors.New("block " + strconv.Itoa(pin.Id) + " is not part of the macro")
+}
+
+// registerMacro adds the macro to the block library.
+func (s *Server) registerMacro(m *Macro) error {
+	if m.Name == "" {
+		return errors.New("macro must have a name")
+	}
+
+	if _, ok := s.library[m.Name]; ok {
+		return errors.New("block type " + m.Name + " already exists")
+	}
+
+	for _, b := range m.Pattern.Blocks {
+		if _, ok := s.macros[b.Type]; ok {
+			return errors.New("macros cannot contain other macros")
+		}
+	}
+
+	spec := core.Spec{
+		Name:    m.Name,
+		Inputs:  []core.Pin{},
+		Outputs: []core.Pin{},
+		Source:  core.NONE,
+	}
+
+	for _, pin := range m.Inputs {
+		p, err := s.pinSpec(m.Pattern, pin, false)
+		if err != nil {
+			return err
+		}
+		spec.Inputs = append(spec.Inputs, p)
+	}
+
+	for _, pin := range m.Outputs {
+		p, err := s.pinSpec(m.Pattern, pin, true)
+		if err != nil {
+			return err
+		}
+		spec.Outputs = append(spec.Outputs, p)
+	}
+
+	s.macros[m.Name] = m
+	s.library[m.Name] = spec
+	return nil
+}
+
+// CreateMacro turns the group into a new block type.
+func (s *Server) CreateMacro(id int, pm ProtoMacro) (*Macro, error) {
+	p, err := s.Export(id)
+	if err != nil {
+		return nil, err
+	}
+	// a macro cannot contain other macros, so it doesn't need their
+	// definitions
+	p.Macros = nil
+
+	m := &Macro{
+		Name:    pm.Name,
+		Group:   id,
+		Pattern: *p,
+		Inputs:  pm.Inputs,
+		Outputs: pm.Outputs,
+	}
+
+	err = s.registerMacro(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s.websocketBroadcast(Update{Action: CREATE, Type: MACRO, Data: wsMacro{m}})
+	return m, nil
+}
+
+func (s *Server) GroupMacroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read request body"})
+		return
+	}
+
+	var pm ProtoMacro
+	err = json.Unmarshal(body, &pm)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read JSON"})
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	m, err := s.CreateMacro(id, pm)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, m)
+}
+
+// newComposite builds and starts a private copy of the macro's pattern. The
+// blocks of the copy report errors as the block id and their state on monitor.
+func (s *Server) newComposite(m *Macro, id int, monitor chan core.MonitorMessage) (*composite, error) {
+	c := &composite{
+		blocks:  make(map[int]*core.Block),
+		sources: make(map[int]core.Source),
+		inputs:  m.Inputs,
+		outputs: m.Outputs,
+		monitor: monitor,
+		quit:    make(chan struct{}),
+	}
+
+	for _, b := range m.Pattern.Blocks {
+		spec, ok := s.library[b.Type]
+		if !ok {
+			c.stop()
+			return nil, errors.New("spec " + b.Type + " not found")
+		}
+		block := core.NewBlock(spec)
+		go c.forward(block.Monitor)
+		go block.Serve()
+		block.SetID(id)
+		block.SetTracer(s.tracer)
+		if b.TypeCheck {
+			block.SetTypeCheck(true)
+		}
+		c.blocks[b.Id] = block
+	}
+
+	for _, source := range m.Pattern.Sources {
+		f, ok := s.sourceLibrary[source.Type]
+		if !ok {
+			c.stop()
+			return nil, errors.New("source type " + source.Type + " does not exist")
+		}
+		ns := f.New()
+		if i, ok := ns.(core.Interface); ok {
+			for _, p := range source.Parameters {
+				i.SetSourceParameter(p["name"], p["value"])
+			}
+			go i.Serve()
+		}
+		c.sources[source.Id] = ns
+	}
+
+	for _, l := range m.Pattern.Links {
+		err := c.blocks[l.Block.Id].SetSource(c.sources[l.Source.Id])
+		if err != nil {
+			c.stop()
+			return nil, err
+		}
+	}
+
+	for _, conn := range m.Pattern.Connections {
+		target, err := c.blocks[conn.Target.Id].GetInput(core.RouteIndex(conn.Target.Route))
+		if err != nil {
+			c.stop()
+			return nil, err
+		}
+		in := target.C
+		if conn.Buffer > 0 {
+			buffer, err := core.NewBuffer(target.C, conn.Buffer, conn.Overflow)
+			if err != nil {
+				c.stop()
+				return nil, err
+			}
+			go buffer.Serve()
+			c.buffers = append(c.buffers, buffer)
+			in = buffer.In
+		}
+		err = c.blocks[conn.Source.Id].Connect(core.RouteIndex(conn.Source.Route), in)
+		if err != nil {
+			c.stop()
+			return nil, err
+		}
+	}
+
+	for _, b := range m.Pattern.Blocks {
+		for route, v := range b.Inputs {
+			if !v.Value.Exists() {
+				continue
+			}
+			err := c.blocks[b.Id].SetInput(core.RouteIndex(route), v.Value)
+			if err != nil {
+				c.stop()
+				return nil, err
+			}
+		}
+	}
+
+	// flush anything that was emitted while the pattern was being wired
+	for _, b := range c.blocks {
+		b.Stop()
+	}
+	for _, buffer := range c.buffers {
+		buffer.Flush()
+	}
+	for _, b := range c.blocks {
+		b.Reset()
+	}
+	for _, b := range c.blocks {
+		go b.Serve()
+	}
+
+	return c, nil
+}
+
+// createComposite creates a block that runs an instance of the macro.
+func (s *Server) createComposite(p ProtoBlock, m *Macro) (*BlockLedger, error) {
+	if _, ok := s.groups[p.Parent]; !ok {
+		return nil, errors.New("invalid group, could not create block")
+	}
+
+	spec := s.library[m.Name]
+
+	b := &BlockLedger{
+		Label:        p.Label,
+		Position:     p.Position,
+		Type:         p.Type,
+		Composition:  m.Group,
+		Source:       core.NONE,
+		State:        RUNNING,
+		Id:           s.GetNextID(),
+		Inputs:       []core.Input{},
+		Outputs:      []core.Output{},
+		MonitorQuit:  make(chan struct{}),
+		MonitorQuery: make(chan struct{}),
+	}
+
+	monitor := make(chan core.MonitorMessage)
+	go s.MonitorMux(b.Id, monitor, b.MonitorQuery, b.MonitorQuit)
+
+	c, err := s.newComposite(m, b.Id, monitor)
+	if err != nil {
+		b.MonitorQuit <- struct{}{}
+		return nil, err
+	}
+	b.composite = c
+
+	for id, pin := range spec.Inputs {
+		block, route, _ := c.input(id)
+		input, err := block.GetInput(route)
+		if err != nil {
+			c.stop()
+			b.MonitorQuit <- struct{}{}
+			return nil, err
+		}
+		b.Inputs = append(b.Inputs, core.Input{
+			Name:  pin.Name,
+			Type:  pin.Type,
+			Value: input.Value,
+		})
+	}
+
+	for _, pin := range spec.Outputs {
+		b.Outputs = append(b.Outputs, core.Output{
+			Name: pin.Name,
+			Type: pin.Type,
+		})
+	}
+
+	s.blocks[b.Id] = b
+
+	s.websocketBroadcast(Update{Action: CREATE, Type: BLOCK, Data: wsBlock{*b}})
+
+	err = s.AddChildToGroup(p.Parent, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nytlabs/st-core/core"
+)
+
+// metrics are exported in the Prometheus text format. block statistics are
+// aggregated by block type so that the number of series doesn't grow with
+// the size of the pattern.
+
+// a source that holds a number of messages
+type lengthSource interface {
+	Len() int
+}
+
+// a source that counts the messages it has brought into the pattern
+type receivingSource interface {
+	Received() uint64
+}
+
+type metrics struct {
+	bytes.Buffer
+}
+
+// family writes the HELP and TYPE lines of a metric.
+func (m *metrics) family(name, kind, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample. labels are given as alternating names and values.
+func (m *metrics) sample(name string, v float64, labels ...string) {
+	m.WriteString(name)
+	if len(labels) > 0 {
+		pairs := []string{}
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+		}
+		m.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.WriteString(" " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics returns the server's metrics in the Prometheus text format.
+func (s *Server) Metrics() []byte {
+	m := &metrics{}
+
+	m.family("st_blocks", "gauge", "Number of blocks.")
+	m.sample("st_blocks", float64(len(s.blocks)))
+	m.family("st_groups", "gauge", "Number of groups.")
+	m.sample("st_groups", float64(len(s.groups)))
+	m.family("st_sources", "gauge", "Number of sources.")
+	m.sample("st_sources", float64(len(s.sources)))
+	m.family("st_connections", "gauge", "Number of connections.")
+	m.sample("st_connections", float64(len(s.connections)))
+	m.family("st_links", "gauge", "Number of links between blocks and sources.")
+	m.sample("st_links", float64(len(s.links)))
+	m.family("st_websocket_clients", "gauge", "Number of connected websocket clients.")
+	m.sample("st_websocket_clients", float64(atomic.LoadInt32(&s.clients)))
+
+	// block statistics by type
+	types := []string{}
+	byType := make(map[string]*core.BlockStats)
+	for _, b := range s.blocks {
+		stats := b.stats()
+		t, ok := byType[b.Type]
+		if !ok {
+			t = &core.BlockStats{
+				In:     []uint64{0},
+				Out:    []uint64{0},
+				Kernel: core.NewHistogram(core.KernelBuckets),
+			}
+			byType[b.Type] = t
+			types = append(types, b.Type)
+		}
+		for _, in := range stats.In {
+			t.In[0] += in
+		}
+		for _, out := range stats.Out {
+			t.Out[0] += out
+		}
+		t.Errors += stats.Errors
+		t.Kernel.Add(stats.Kernel)
+		t.Receiving += stats.Receiving
+		t.Broadcasting += stats.Broadcasting
+	}
+	sort.Strings(types)
+
+	m.family("st_block_messages_in_total", "counter", "Messages received by blocks.")
+	for _, t := range types {
+		m.sample("st_block_messages_in_total", float64(byType[t].In[0]), "type", t)
+	}
+	m.family("st_block_messages_out_total", "counter", "Messages emitted by blocks, including errors.")
+	for _, t := range types {
+		m.sample("st_block_messages_out_total", float64(byType[t].Out[0]), "type", t)
+	}
+	m.family("st_block_errors_total", "counter", "Errors emitted or discarded by blocks.")
+	for _, t := range types {
+		m.sample("st_block_errors_total", float64(byType[t].Errors), "type", t)
+	}
+	m.family("st_block_receive_wait_seconds_total", "counter", "Time blocks have spent waiting for inputs.")
+	for _, t := range types {
+		m.sample("st_block_receive_wait_seconds_total", byType[t].Receiving, "type", t)
+	}
+	m.family("st_block_broadcast_wait_seconds_total", "counter", "Time blocks have spent waiting to deliver outputs.")
+	for _, t := range types {
+		m.sample("st_block_broadcast_wait_seconds_total", byType[t].Broadcasting, "type", t)
+	}
+	m.family("st_block_kernel_seconds", "histogram", "Kernel execution time.")
+	for _, t := range types {
+		h := byType[t].Kernel
+		var cumulative uint64
+		for i, bound := range h.Bounds {
+			cumulative += h.Counts[i]
+			m.sample("st_block_kernel_seconds_bucket", float64(cumulative), "type", t, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		m.sample("st_block_kernel_seconds_bucket", float64(h.Count), "type", t, "le", "+Inf")
+		m.sample("st_block_kernel_seconds_sum", h.Sum, "type", t)
+		m.sample("st_block_kernel_seconds_count", float64(h.Count), "type", t)
+	}
+
+	// source specific figures
+	ids := []int{}
+	for id := range s.sources {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	m.family("st_source_length", "gauge", "Number of messages held by list and priority queue sources.")
+	for _, id := range ids {
+		if l, ok := s.sources[id].Source.(lengthSource); ok {
+			m.sample("st_source_length", float64(l.Len()), "id", strconv.Itoa(id), "type", s.sources[id].Type)
+		}
+	}
+	m.family("st_source_received_total", "counter", "Messages received by stream sources.")
+	for _, id := range ids {
+		if r, ok := s.sources[id].Source.(receivingSource); ok {
+			m.sample("st_source_received_total", float64(r.Received()), "id", strconv.Itoa(id), "type", s.sources[id].Type)
+		}
+	}
+
+	return m.Bytes()
+}
+
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	d := s.Metrics()
+	s.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	w.Write(d)
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/nytlabs/st-core/core"
@@ -34,7 +37,18 @@ func (s *Server) MonitorMux(id int, c chan core.MonitorMessage, query chan struc
 	for {
 		select {
 		case m := <-c:
+			// errors are emitted as they happen rather than as a change
+			// of state
+			if m.Type == core.BI_ERROR {
+				if s.settings.LogErrors {
+					log.Println("block", id, "error:", m.Data)
+				}
+				m.Data = reportable(m.Data)
+				s.websocketBroadcast(Update{Action: INFO, Type: BLOCK, Data: wsBlock{wsInfo{wsId{id}, m}}})
+				continue
+			}
 			state = m
+			s.setState(id, m)
 			expire.Reset(time.Duration(250 * time.Millisecond))
 			if !running {
 				running = true
@@ -47,6 +61,7 @@ func (s *Server) MonitorMux(id int, c chan core.MonitorMessage, query chan struc
 			s.websocketBroadcast(Update{Action: INFO, Type: BLOCK, Data: wsBlock{wsInfo{wsId{id}, state}}})
 			running = false
 		case <-quit:
+			s.clearState(id)
 			return
 		case <-query:
 			if running {
@@ -60,3 +75,22 @@ func (s *Server) MonitorMux(id int, c chan core.MonitorMessage, query chan struc
 		}
 	}
 }
+
+// reportable returns an error that can be marshalled to JSON. the inputs of an
+// ErrorMessage are whatever the block received, so an input that can't be
+// marshalled, like NaN, is replaced by its printed form.
+func reportable(d interface{}) interface{} {
+	e, ok := d.(*core.ErrorMessage)
+	if !ok {
+		return d
+	}
+	r := *e
+	r.Inputs = make([]core.Message, len(e.Inputs))
+	for i, m := range e.Inputs {
+		r.Inputs[i] = m
+		if _, err := json.Marshal(m); err != nil {
+			r.Inputs[i] = fmt.Sprint(m)
+		}
+	}
+	return &r
+}
@@ -75,6 +75,36 @@ func (s *Server) NewRouter() *mux.Router {
 			"GET",
 			s.GroupImportGistHandler,
 		},
+		Route{
+			"GroupMacro",
+			"/groups/{id}/macro",
+			"POST",
+			s.GroupMacroHandler,
+		},
+		Route{
+			"GroupStart",
+			"/groups/{id}/start",
+			"POST",
+			s.GroupStartHandler,
+		},
+		Route{
+			"GroupPause",
+			"/groups/{id}/pause",
+			"POST",
+			s.GroupPauseHandler,
+		},
+		Route{
+			"GroupStop",
+			"/groups/{id}/stop",
+			"POST",
+			s.GroupStopHandler,
+		},
+		Route{
+			"GroupReset",
+			"/groups/{id}/reset",
+			"POST",
+			s.GroupResetHandler,
+		},
 		Route{
 			"GroupModifyLabel",
 			"/groups/{id}/label",
@@ -123,6 +153,12 @@ func (s *Server) NewRouter() *mux.Router {
 			"POST",
 			s.BlockCreateHandler,
 		},
+		Route{
+			"BlockStats",
+			"/blocks/{id}/stats",
+			"GET",
+			s.BlockStatsHandler,
+		},
 		Route{
 			"BlockDelete",
 			"/blocks/{id}",
@@ -141,6 +177,18 @@ func (s *Server) NewRouter() *mux.Router {
 			"PUT",
 			s.BlockModifyRouteHandler,
 		},
+		Route{
+			"BlockModifySync",
+			"/blocks/{id}/sync",
+			"PUT",
+			s.BlockModifySyncHandler,
+		},
+		Route{
+			"BlockModifyTypeCheck",
+			"/blocks/{id}/typecheck",
+			"PUT",
+			s.BlockModifyTypeCheckHandler,
+		},
 		Route{
 			"BlockModifyPosition",
 			"/blocks/{id}/position",
@@ -171,6 +219,24 @@ func (s *Server) NewRouter() *mux.Router {
 			"PUT",
 			s.ConnectionModifyCoordinates,
 		},
+		Route{
+			"ConnectionModifyBuffer",
+			"/connections/{id}/buffer",
+			"PUT",
+			s.ConnectionModifyBufferHandler,
+		},
+		Route{
+			"ConnectionTap",
+			"/connections/{id}/tap",
+			"POST",
+			s.ConnectionTapHandler,
+		},
+		Route{
+			"ConnectionUntap",
+			"/connections/{id}/tap",
+			"DELETE",
+			s.ConnectionUntapHandler,
+		},
 		Route{
 			"ConnectionDelete",
 			"/connections/{id}",
@@ -219,6 +285,12 @@ func (s *Server) NewRouter() *mux.Router {
 			"PUT",
 			s.SourceSetValueHandler,
 		},
+		Route{
+			"SourceReplay",
+			"/sources/{id}/replay",
+			"POST",
+			s.SourceReplayHandler,
+		},
 		Route{
 			"Source",
 			"/sources/{id}",
@@ -249,6 +321,24 @@ func (s *Server) NewRouter() *mux.Router {
 			"DELETE",
 			s.LinkDeleteHandler,
 		},
+		Route{
+			"TraceIndex",
+			"/traces",
+			"GET",
+			s.TraceIndexHandler,
+		},
+		Route{
+			"Trace",
+			"/traces/{id}",
+			"GET",
+			s.TraceHandler,
+		},
+		Route{
+			"Metrics",
+			"/metrics",
+			"GET",
+			s.MetricsHandler,
+		},
 	}
 	router := mux.NewRouter().StrictSlash(true)
 	for _, route := range routes {
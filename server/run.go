@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// LoadPattern reads a pattern from a file, as written by Export, and imports
+// it into the root group. The pattern's blocks and sources start running as
+// soon as it is imported.
+func (s *Server) LoadPattern(path string) error {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var p Pattern
+	err = json.Unmarshal(d, &p)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.importRoot(p)
+}
@@ -18,6 +18,7 @@ const (
 	BLOCK  = "block"
 	GROUP  = "group"
 	SOURCE = "source"
+	MACRO  = "macro"
 	// edges
 	LINK       = "link"
 	CONNECTION = "connection"
@@ -25,17 +26,26 @@ const (
 	CHILD = "child"
 	ROUTE = "route"
 	PARAM = "param"
+	// messages
+	TRACE = "trace"
+	TAP   = "tap"
 )
 
 // user-session specific settings
 type Settings struct {
 	GithubUserToken string
+	PatternFile     string  // where the running pattern is persisted. a missing key means ~/.st.pattern.json, and empty disables persistence.
+	LogErrors       bool    // write block errors to the log as well as to the websocket
+	DrainTimeout    string  // how long messages are given to drain on shutdown, e.g. "5s"
+	TraceSample     float64 // the fraction of incoming messages that are traced. 0 disables tracing.
 }
 
 // NewSettings returns the default settings object
 func NewSettings() Settings {
 	return Settings{
 		GithubUserToken: "",
+		PatternFile:     "",
+		DrainTimeout:    "5s",
 	}
 }
 
@@ -49,12 +59,20 @@ type Server struct {
 	sources       map[int]*SourceLedger
 	links         map[int]*LinkLedger
 	library       map[string]core.Spec
+	macros        map[string]*Macro
 	sourceLibrary map[string]core.SourceSpec
 	lastID        int
 	addSocket     chan *socket
 	delSocket     chan *socket
 	broadcast     chan []byte
-	emitChan      chan []byte
+	tapBroadcast  chan tapMessage
+	taps          map[int]*TapLedger // keyed by connection id
+	store         *store
+	tracer        *tracer
+	clients       int32                       // the number of connected websocket clients, accessed atomically
+	states        map[int]core.MonitorMessage // the last state reported by each block's monitor
+	statesLock    sync.Mutex
+	statsQuit     chan struct{} // closed by Shutdown to stop the stats router
 	sync.Mutex
 }
 
@@ -84,16 +102,36 @@ func NewServer(settings Settings) *Server {
 		sourceLibrary: sourceLibrary,
 		connections:   connections,
 		library:       library,
+		macros:        make(map[string]*Macro),
+		states:        make(map[int]core.MonitorMessage),
 		links:         links,
 		sources:       sources,
 		addSocket:     make(chan *socket),
 		delSocket:     make(chan *socket),
 		broadcast:     make(chan []byte),
-		emitChan:      make(chan []byte),
+		tapBroadcast:  make(chan tapMessage),
+		taps:          make(map[int]*TapLedger),
+		statsQuit:     make(chan struct{}),
 	}
+	s.tracer = newTracer(s, settings.TraceSample)
+
 	// ws stuff
 	log.Println("starting websocker handler")
 	go s.websocketRouter()
+	go s.statsRouter(s.statsQuit)
+
+	if settings.PatternFile != "" {
+		s.store = newStore(settings.PatternFile)
+		log.Println("restoring pattern from", settings.PatternFile)
+		err := s.Restore()
+		if err != nil {
+			// don't overwrite a pattern that we couldn't read
+			log.Println("could not restore pattern, persistence disabled:", err)
+			s.store = nil
+		} else {
+			go s.persistRouter()
+		}
+	}
 	return s
 }
 
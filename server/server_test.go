@@ -6,12 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/gorilla/websocket"
+	"github.com/nytlabs/st-core/core"
 )
 
 var warn = color.New(color.FgYellow).Add(color.Bold).Println
@@ -254,3 +260,931 @@ func TestEndpoints(t *testing.T) {
 	del("/connections/", 404)                                                             //delete unspecified connection
 	del("/connections/invalid", 400)                                                      //delete malformed connection
 }
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "st-core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := NewSettings()
+	settings.PatternFile = dir + "/pattern.json"
+
+	s := NewServer(settings)
+	s.Lock()
+	g, err := s.CreateGroup(ProtoGroup{Label: "persisted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := s.CreateBlock(ProtoBlock{Type: "+", Parent: g.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := s.CreateBlock(ProtoBlock{Type: "log", Parent: g.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{b1.Id, 0},
+		Target: ConnectionNode{b2.Id, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ModifyBlockRoute(b1.Id, 0, &core.InputValue{Data: 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := s.CreateSource(ProtoSource{Type: "stream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ModifySource(source.Id, []map[string]string{{"name": "topic", "value": "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateMacro(g.Id, ProtoMacro{
+		Name:    "summer",
+		Inputs:  []MacroPin{{b1.Id, 0, "a"}, {b1.Id, 1, "b"}},
+		Outputs: []MacroPin{{b1.Id, 0, "sum"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+
+	err = s.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewServer(settings)
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.blocks) != 2 || len(r.connections) != 1 || len(r.sources) != 1 || len(r.groups) != 2 {
+		t.Fatal("restored pattern does not match persisted pattern")
+	}
+	if _, ok := r.macros["summer"]; !ok {
+		t.Error("restored pattern lost a macro without instances")
+	}
+
+	for _, b := range r.blocks {
+		if b.Type == "+" && (b.Inputs[0].Value == nil || b.Inputs[0].Value.Data != 1.0) {
+			t.Error("restored block lost its input value")
+		}
+		if b.Parent == nil || b.Parent.Label != "persisted" {
+			t.Error("restored block is not in its group")
+		}
+	}
+
+	for _, source := range r.sources {
+		for _, p := range source.Parameters {
+			if p["name"] == "topic" && p["value"] != "test" {
+				t.Error("restored source lost its parameters")
+			}
+		}
+	}
+}
+
+func TestConnectionTypes(t *testing.T) {
+	s := NewServer(NewSettings())
+	s.Lock()
+	defer s.Unlock()
+
+	sum, err := s.CreateBlock(ProtoBlock{Type: "+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.CreateBlock(ProtoBlock{Type: "keys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse, err := s.CreateBlock(ProtoBlock{Type: "parseJSON"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := s.CreateBlock(ProtoBlock{Type: "log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flush, err := s.CreateBlock(ProtoBlock{Type: "flush"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := s.CreateBlock(ProtoBlock{Type: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// number into any
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{sum.Id, 0},
+		Target: ConnectionNode{log.Id, 0},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// number into object, with and without coercion
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{sum.Id, 0},
+		Target: ConnectionNode{keys.Id, 0},
+	})
+	if err == nil {
+		t.Error("connected number output to object input")
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{sum.Id, 0},
+		Target: ConnectionNode{keys.Id, 0},
+		Coerce: true,
+	})
+	if err == nil {
+		t.Error("coerced number output to object input")
+	}
+
+	// number into string, with and without coercion
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{sum.Id, 0},
+		Target: ConnectionNode{parse.Id, 0},
+	})
+	if err == nil {
+		t.Error("connected number output to string input")
+	}
+	conn, err := s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{sum.Id, 0},
+		Target: ConnectionNode{parse.Id, 0},
+		Coerce: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.blocks[conn.Source.Id].Type != "toString" {
+		t.Error("coerced connection did not insert toString")
+	}
+	// error into any
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{keys.Id, 1},
+		Target: ConnectionNode{log.Id, 0},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// error into number
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{parse.Id, 1},
+		Target: ConnectionNode{sum.Id, 0},
+	})
+	if err == nil {
+		t.Error("connected error output to number input")
+	}
+
+	// writers only connect to writers
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{flush.Id, 0},
+		Target: ConnectionNode{log.Id, 0},
+	})
+	if err == nil {
+		t.Error("connected writer output to any input")
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{identity.Id, 0},
+		Target: ConnectionNode{flush.Id, 0},
+	})
+	if err == nil {
+		t.Error("connected any output to writer input")
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{flush.Id, 0},
+		Target: ConnectionNode{flush.Id, 0},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(s.connections) != 5 {
+		t.Error("expected 5 connections, found", len(s.connections))
+	}
+}
+
+func TestMacro(t *testing.T) {
+	s := NewServer(NewSettings())
+	s.Lock()
+	defer s.Unlock()
+
+	g, err := s.CreateGroup(ProtoGroup{Label: "adder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := s.CreateBlock(ProtoBlock{Type: "+", Parent: g.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.CreateMacro(g.Id, ProtoMacro{
+		Name:    "adder",
+		Inputs:  []MacroPin{{sum.Id, 0, "a"}, {sum.Id, 1, "b"}},
+		Outputs: []MacroPin{{sum.Id, 0, "sum"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateMacro(g.Id, ProtoMacro{Name: "adder"})
+	if err == nil {
+		t.Error("created two macros with the same name")
+	}
+
+	blocks := len(s.blocks)
+	_, err = s.CreateBlock(ProtoBlock{Type: "adder", Sync: core.SYNC_ANY})
+	if err == nil {
+		t.Error("created a composite with a sync mode")
+	}
+	if len(s.blocks) != blocks {
+		t.Error("a composite that could not be created was left in the pattern")
+	}
+
+	first, err := s.CreateBlock(ProtoBlock{Type: "adder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.CreateBlock(ProtoBlock{Type: "adder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Inputs) != 2 || len(first.Outputs) != 1 || first.Inputs[0].Name != "a" {
+		t.Fatal("macro instance has the wrong pins")
+	}
+
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{first.Id, 0},
+		Target: ConnectionNode{second.Id, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan core.Message)
+	block, route, err := second.output(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Connect(route, out)
+
+	for _, v := range []struct {
+		id, route int
+		value     float64
+	}{{first.Id, 0, 1}, {first.Id, 1, 2}, {second.Id, 1, 10}} {
+		err = s.ModifyBlockRoute(v.id, v.route, &core.InputValue{Data: v.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m := <-out; m != 13.0 {
+		t.Error("expected 13 from chained macros, got", m)
+	}
+
+	// the first macro runs on its input values continuously, so the second
+	// may have received more than one message on its connected pin
+	if stats := second.stats(); stats.In[0] < 1 || stats.In[1] != 0 {
+		t.Error("macro stats do not count its exposed pins")
+	}
+
+	// connections inside a macro keep their buffers
+	pair, err := s.CreateGroup(ProtoGroup{Label: "pair"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.CreateBlock(ProtoBlock{Type: "identity", Parent: pair.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateBlock(ProtoBlock{Type: "identity", Parent: pair.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{a.Id, 0},
+		Target: ConnectionNode{b.Id, 0},
+		Buffer: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateMacro(pair.Id, ProtoMacro{
+		Name:    "pair",
+		Inputs:  []MacroPin{{a.Id, 0, "in"}},
+		Outputs: []MacroPin{{b.Id, 0, "out"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.Export(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Macros) != 2 || p.Macros[0].Name != "adder" || p.Macros[1].Name != "pair" {
+		t.Error("exported pattern does not include every macro")
+	}
+
+	instance, err := s.CreateBlock(ProtoBlock{Type: "pair"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instance.composite.buffers) != 1 || instance.composite.buffers[0].Len() != 0 {
+		t.Error("macro instance did not buffer its connection")
+	}
+}
+
+func TestLoadPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "st-core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewServer(NewSettings())
+	s.Lock()
+	b1, err := s.CreateBlock(ProtoBlock{Type: "+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := s.CreateBlock(ProtoBlock{Type: "log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{b1.Id, 0},
+		Target: ConnectionNode{b2.Id, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateSource(ProtoSource{Type: "key_value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Export(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+
+	d, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(dir+"/pattern.json", d, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewServer(NewSettings())
+	err = r.LoadPattern(dir + "/pattern.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.blocks) != 2 || len(r.connections) != 1 || len(r.sources) != 1 {
+		t.Error("loaded pattern does not match exported pattern")
+	}
+	r.Stop()
+
+	err = r.LoadPattern(dir + "/missing.json")
+	if err == nil {
+		t.Error("loaded a pattern that does not exist")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "st-core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := NewSettings()
+	settings.PatternFile = dir + "/pattern.json"
+	settings.DrainTimeout = "2s"
+
+	s := NewServer(settings)
+	s.Lock()
+	b1, err := s.CreateBlock(ProtoBlock{Type: "+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := s.CreateBlock(ProtoBlock{Type: "+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{b1.Id, 0},
+		Target: ConnectionNode{b2.Id, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateSource(ProtoSource{Type: "key_value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ModifyBlockRoute(b1.Id, 0, &core.InputValue{Data: 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+
+	err = s.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(settings.PatternFile); err != nil {
+		t.Error("pattern was not flushed on shutdown")
+	}
+
+	// blocks waiting on a timer don't hold up the drain
+	s = NewServer(settings)
+	s.Lock()
+	ticker, err := s.CreateBlock(ProtoBlock{Type: "ticker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delay, err := s.CreateBlock(ProtoBlock{Type: "delay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ModifyBlockRoute(ticker.Id, 0, &core.InputValue{Data: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ModifyBlockRoute(delay.Id, 1, &core.InputValue{Data: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+	in, _ := delay.Block.GetInput(0)
+	in.C <- "later"
+	for {
+		s.statesLock.Lock()
+		waiting := s.states[ticker.Id].Type == core.BI_KERNEL && s.states[delay.Id].Type == core.BI_KERNEL
+		s.statesLock.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	err = s.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) >= 2*time.Second {
+		t.Error("waited for timers to drain")
+	}
+
+	settings = NewSettings()
+	settings.DrainTimeout = "soon"
+	s = NewServer(settings)
+	if s.Shutdown() == nil {
+		t.Error("shut down with an invalid drain timeout")
+	}
+}
+
+func TestGroupControl(t *testing.T) {
+	s := NewServer(NewSettings())
+	s.Lock()
+	defer s.Unlock()
+
+	parent, err := s.CreateGroup(ProtoGroup{Label: "parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := s.CreateGroup(ProtoGroup{Label: "child", Group: parent.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateBlock(ProtoBlock{Type: "identity", Parent: child.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan core.Message)
+	b.Block.Connect(0, out)
+	in, err := b.Block.GetInput(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quiet := func() bool {
+		select {
+		case <-out:
+			return false
+		case <-time.After(50 * time.Millisecond):
+			return true
+		}
+	}
+
+	// a paused block picks up where it left off
+	err = s.ControlGroup(parent.Id, PAUSED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.State != PAUSED || child.State != PAUSED {
+		t.Error("pausing a group did not pause its descendants")
+	}
+	in.C <- "paused"
+	if !quiet() {
+		t.Error("paused block emitted a message")
+	}
+	err = s.ControlGroup(parent.Id, RUNNING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := <-out; m != "paused" {
+		t.Error("resumed block emitted", m)
+	}
+
+	// a stopped block starts from scratch
+	err = s.ControlGroup(parent.Id, PAUSED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.C <- "stopped"
+	err = s.ControlGroup(parent.Id, STOPPED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.ControlGroup(parent.Id, RUNNING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quiet() {
+		t.Error("stopped block kept its messages")
+	}
+
+	if s.ResetGroup(parent.Id) != nil || s.ControlGroup(parent.Id, "sleeping") == nil || s.ControlGroup(-1, PAUSED) == nil {
+		t.Error("unexpected result controlling group")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := NewServer(NewSettings())
+	server := httptest.NewServer(s.NewRouter())
+	defer server.Close()
+
+	s.Lock()
+	for _, p := range []string{"+", "+", "log"} {
+		_, err := s.CreateBlock(ProtoBlock{Type: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.CreateSource(ProtoSource{Type: "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Source.(core.Store).Set([]interface{}{1.0, 2.0})
+	s.Unlock()
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"st_blocks 3\n",
+		"st_sources 1\n",
+		"# TYPE st_block_kernel_seconds histogram\n",
+		`st_block_messages_in_total{type="+"} 0` + "\n",
+		`st_block_kernel_seconds_bucket{type="log",le="+Inf"} 0` + "\n",
+		`st_source_length{id="` + strconv.Itoa(list.Id) + `",type="list"} 2` + "\n",
+	} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Error("metrics do not contain", expected)
+		}
+	}
+}
+
+func TestTraces(t *testing.T) {
+	settings := NewSettings()
+	settings.TraceSample = 1
+	s := NewServer(settings)
+	server := httptest.NewServer(s.NewRouter())
+	defer server.Close()
+
+	id, ok := s.tracer.Start()
+	if !ok {
+		t.Fatal("trace was not sampled")
+	}
+	s.tracer.Record(core.Hop{Trace: id, Block: 4, Inputs: []string{"in"}})
+	s.tracer.Record(core.Hop{Trace: id + 1, Block: 5})
+
+	res, err := http.Get(server.URL + "/traces/" + strconv.Itoa(int(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hops []core.Hop
+	err = json.NewDecoder(res.Body).Decode(&hops)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 1 || hops[0].Block != 4 {
+		t.Error("unexpected hops in trace", hops)
+	}
+
+	res, err = http.Get(server.URL + "/traces/" + strconv.Itoa(int(id+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Error("found a trace that was never started")
+	}
+
+	if _, ok := newTracer(s, 0).Start(); ok {
+		t.Error("started a trace with tracing disabled")
+	}
+}
+
+func TestTap(t *testing.T) {
+	s := NewServer(NewSettings())
+	server := httptest.NewServer(s.NewRouter())
+	defer server.Close()
+
+	s.Lock()
+	a, err := s.CreateBlock(ProtoBlock{Type: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateBlock(ProtoBlock{Type: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{a.Id, 0},
+		Target: ConnectionNode{b.Id, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateTap(conn.Id, ProtoTap{Size: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateTap(conn.Id, ProtoTap{})
+	if err == nil {
+		t.Error("tapped a connection twice")
+	}
+	s.Unlock()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/updates", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// the socket handles its messages in order, so once the pattern has been
+	// listed the socket is subscribed to the tap. messages that aren't
+	// commands are ignored rather than holding up the ones after them.
+	ws.WriteMessage(websocket.TextMessage, []byte("hello"))
+	ws.WriteMessage(websocket.TextMessage, []byte("tap "+strconv.Itoa(conn.Id)))
+	ws.WriteMessage(websocket.TextMessage, []byte("list"))
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, _ := a.Block.GetInput(0)
+	in.C <- "a message longer than the tap"
+
+	for {
+		_, d, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var u struct {
+			Action string
+			Type   string
+			Data   struct {
+				Tap wsTapMessage
+			}
+		}
+		json.Unmarshal(d, &u)
+		if u.Type != TAP || u.Action != INFO {
+			continue
+		}
+		if u.Data.Tap.Id != conn.Id || u.Data.Tap.Message != `"a messa` || !u.Data.Tap.Truncated {
+			t.Error("unexpected tap message", string(d))
+		}
+		break
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	err = s.DeleteConnection(conn.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.taps) != 0 {
+		t.Error("deleting a connection did not delete its tap")
+	}
+
+	if d := truncate([]byte(`"añb"`), 3); string(d) != `"a` {
+		t.Error("truncated a message inside a character", string(d))
+	}
+}
+
+func TestErrorInputs(t *testing.T) {
+	s := NewServer(NewSettings())
+	server := httptest.NewServer(s.NewRouter())
+	defer server.Close()
+
+	s.Lock()
+	b, err := s.CreateBlock(ProtoBlock{Type: "concat", TypeCheck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/updates", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte("list"))
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NaN can't be marshalled, so the error reports it as a string
+	in, _ := b.Block.GetInput(0)
+	in.C <- math.NaN()
+
+	for {
+		_, d, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var u struct {
+			Action string
+			Type   string
+			Data   struct {
+				Block struct {
+					Type string
+					Data struct {
+						Inputs []core.Message
+					}
+				}
+			}
+		}
+		json.Unmarshal(d, &u)
+		if u.Type != BLOCK || u.Action != INFO || u.Data.Block.Data.Inputs == nil {
+			continue
+		}
+		if u.Data.Block.Type != "error" || u.Data.Block.Data.Inputs[0] != "NaN" {
+			t.Error("unexpected error", string(d))
+		}
+		break
+	}
+}
+
+func TestConnectionBuffer(t *testing.T) {
+	s := NewServer(NewSettings())
+
+	s.Lock()
+	defer s.Unlock()
+
+	a, err := s.CreateBlock(ProtoBlock{Type: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateBlock(ProtoBlock{Type: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateConnection(ProtoConnection{
+		Source: ConnectionNode{a.Id, 0},
+		Target: ConnectionNode{b.Id, 0},
+		Buffer: -1,
+	})
+	if err == nil {
+		t.Error("created a connection with a negative buffer")
+	}
+	conn, err := s.CreateConnection(ProtoConnection{
+		Source:   ConnectionNode{a.Id, 0},
+		Target:   ConnectionNode{b.Id, 0},
+		Buffer:   2,
+		Overflow: core.OVERFLOW_DROP_OLDEST,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing reads from b, so b and its input hold the first two messages
+	// and the buffer holds the newest two of the rest
+	b.Block.Connect(0, make(core.Connection))
+	in, _ := a.Block.GetInput(0)
+	for i := 0; i < 6; i++ {
+		in.C <- i
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.snapshot().Dropped != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c := conn.snapshot()
+	if c.Depth != 2 || c.Dropped != 2 {
+		t.Error("buffer has depth", c.Depth, "and dropped", c.Dropped)
+	}
+
+	_, err = s.ModifyConnectionBuffer(conn.Id, ProtoBuffer{Buffer: 1, Overflow: core.OVERFLOW_DROP_NEWEST})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := conn.snapshot(); c.Depth != 1 || c.Overflow != core.OVERFLOW_DROP_NEWEST {
+		t.Error("resized buffer has depth", c.Depth, "and policy", c.Overflow)
+	}
+
+	_, err = s.ModifyConnectionBuffer(conn.Id, ProtoBuffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.buffer != nil || conn.Buffer != 0 {
+		t.Error("could not remove buffer")
+	}
+	_, err = s.ModifyConnectionBuffer(conn.Id, ProtoBuffer{Buffer: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.Export(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Connections) != 1 || p.Connections[0].Buffer != 4 {
+		t.Error("buffer was not exported", p.Connections)
+	}
+
+	err = s.DeleteConnection(conn.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockSync(t *testing.T) {
+	s := NewServer(NewSettings())
+
+	s.Lock()
+	defer s.Unlock()
+
+	_, err := s.CreateBlock(ProtoBlock{Type: "+", Sync: core.SYNC_WINDOW})
+	if err == nil {
+		t.Error("created a block with a window sync mode but no window")
+	}
+
+	b, err := s.CreateBlock(ProtoBlock{Type: "+", Sync: core.SYNC_WINDOW, Window: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Sync != core.SYNC_WINDOW || b.Window != "50ms" {
+		t.Error("block was created with sync mode", b.Sync, b.Window)
+	}
+
+	err = s.ModifyBlockSync(b.Id, ProtoSync{Sync: core.SYNC_WINDOW, Window: "-1s"})
+	if err == nil {
+		t.Error("set a negative sync window")
+	}
+	err = s.ModifyBlockSync(b.Id, ProtoSync{Sync: core.SYNC_ANY, Window: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Sync != core.SYNC_ANY || b.Window != "" {
+		t.Error("block has sync mode", b.Sync, b.Window)
+	}
+
+	var p ProtoSync
+	err = json.Unmarshal([]byte(`{"sync":"sometimes"}`), &p)
+	if err == nil {
+		t.Error("unmarshalled an unknown sync mode")
+	}
+
+	d, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(d), `"sync":"any"`) {
+		t.Error("sync mode missing from ledger", string(d))
+	}
+}
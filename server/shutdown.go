@@ -0,0 +1,215 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/nytlabs/st-core/core"
+)
+
+// shutting down a pattern happens in stages. first the ingress sources, the
+// sources that bring messages into the pattern from outside, are stopped.
+// the messages that are already in the pattern are then given until the drain
+// timeout to work their way through it. finally every block and remaining
+// source is stopped and the pattern is flushed to disk.
+//
+// the pattern is drained when no block is busy. a block is busy if it is
+// running its kernel or delivering a message to a connection, as reported by
+// its monitor. kernels that wait on an ingress source never return once the
+// source is stopped, so blocks linked to ingress sources are not counted.
+// neither are blocks whose kernels wait on a timer, like ticker or delay,
+// since the timer can be set to go off long after the drain timeout.
+
+const drainPoll = 50 * time.Millisecond
+
+// ingress returns true if the source brings messages into the pattern from
+// outside of st-core.
+func ingress(t core.SourceType) bool {
+	switch t {
+	case core.STREAM, core.SERVER:
+		return true
+	}
+	return false
+}
+
+func (s *Server) setState(id int, m core.MonitorMessage) {
+	s.statesLock.Lock()
+	s.states[id] = m
+	s.statesLock.Unlock()
+}
+
+func (s *Server) clearState(id int) {
+	s.statesLock.Lock()
+	delete(s.states, id)
+	s.statesLock.Unlock()
+}
+
+// timed returns true if the kernel of the block waits on a timer. preemptible
+// kernels wait on one until their next message arrives.
+func (s *Server) timed(b *BlockLedger) bool {
+	if b.Type == "delay" {
+		return true
+	}
+	spec, ok := s.library[b.Type]
+	return ok && spec.Preempt
+}
+
+// busy returns true if the block is still working on a message.
+func (s *Server) busy(b *BlockLedger, m core.MonitorMessage) bool {
+	// paused and stopped blocks won't finish what they are working on
+	if b.State != RUNNING {
+		return false
+	}
+	switch m.Type {
+	case core.BI_KERNEL:
+		if s.timed(b) {
+			return false
+		}
+		for _, l := range s.links {
+			if l.Block.Id != b.Id {
+				continue
+			}
+			if source, ok := s.sources[l.Source.Id]; ok && ingress(source.Source.GetType()) {
+				return false
+			}
+		}
+		return true
+	case core.BI_OUTPUT:
+		// the routes of a composite's monitor messages are those of its
+		// internal blocks
+		if b.composite != nil {
+			return true
+		}
+		// an output without connections can't deliver its message
+		for _, c := range s.connections {
+			if c.Source.Id == b.Id && m.Data == c.Source.Route {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// drained returns true if no block on the server is busy.
+func (s *Server) drained() bool {
+	s.Lock()
+	defer s.Unlock()
+	s.statesLock.Lock()
+	defer s.statesLock.Unlock()
+
+	for id, m := range s.states {
+		b, ok := s.blocks[id]
+		if ok && s.busy(b, m) {
+			return false
+		}
+	}
+	// messages waiting in a buffer will be delivered to a running block
+	for _, c := range s.connections {
+		if c.buffer == nil || c.buffer.Len() == 0 {
+			continue
+		}
+		if b, ok := s.blocks[c.Target.Id]; ok && b.State == RUNNING {
+			return false
+		}
+	}
+	return true
+}
+
+// drain waits until the pattern has drained, or the timeout has passed.
+func (s *Server) drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	// a message in transit between two blocks can make the pattern look
+	// drained for an instant, so the pattern has to look drained twice in
+	// a row.
+	idle := 0
+	for time.Now().Before(deadline) {
+		if s.drained() {
+			idle++
+		} else {
+			idle = 0
+		}
+		if idle == 2 {
+			return true
+		}
+		time.Sleep(drainPoll)
+	}
+	return false
+}
+
+// stopSources stops either the ingress sources, or every other source.
+func (s *Server) stopSources(in bool) {
+	stop := func(source core.Source) {
+		if ingress(source.GetType()) != in {
+			return
+		}
+		if si, ok := source.(core.Interface); ok {
+			si.Stop()
+		}
+	}
+
+	for _, source := range s.sources {
+		stop(source.Source)
+	}
+	for _, b := range s.blocks {
+		if b.composite == nil {
+			continue
+		}
+		for _, source := range b.composite.sources {
+			stop(source)
+		}
+	}
+}
+
+func (s *Server) stopBlocks() {
+	for _, b := range s.blocks {
+		for _, block := range b.cores() {
+			block.Stop()
+		}
+	}
+}
+
+// Stop stops every block and source on the server. The pattern is left in
+// place, but nothing in it runs again.
+func (s *Server) Stop() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stopSources(true)
+	s.stopBlocks()
+	s.stopSources(false)
+}
+
+// Shutdown stops the pattern, giving the messages already in it until the
+// drain timeout set in the server's settings to work through it, and then
+// flushes the pattern to disk. If the drain timeout can't be parsed, the
+// pattern is stopped without draining and the parse error is returned.
+func (s *Server) Shutdown() error {
+	drainTimeout := s.settings.DrainTimeout
+	if drainTimeout == "" {
+		drainTimeout = NewSettings().DrainTimeout
+	}
+	timeout, parseErr := time.ParseDuration(drainTimeout)
+
+	s.Lock()
+	if s.statsQuit != nil {
+		close(s.statsQuit)
+		s.statsQuit = nil
+	}
+	s.stopSources(true)
+	s.Unlock()
+
+	if parseErr == nil && !s.drain(timeout) {
+		log.Println("pattern did not drain within", timeout)
+	}
+
+	s.Lock()
+	s.stopBlocks()
+	s.stopSources(false)
+	s.Unlock()
+
+	err := s.Flush()
+	if err != nil {
+		return err
+	}
+	return parseErr
+}
@@ -436,3 +436,59 @@ func (s *Server) SetSourceValue(id int, body []byte) error {
 
 	return nil
 }
+
+func (s *Server) SourceReplayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = s.ReplaySource(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReplaySource replays the inputs of every letter held by a dead letter source
+// on the block that failed on them. Letters whose block no longer
+// exists, or whose inputs no longer match the block, are kept in the source.
+func (s *Server) ReplaySource(id int) error {
+	source, ok := s.sources[id]
+	if !ok {
+		return errors.New("source does not exist")
+	}
+
+	d, ok := source.Source.(*core.DeadLetter)
+	if !ok {
+		return errors.New("can only replay dead letter sources")
+	}
+
+	d.Lock()
+	letters := d.Drain()
+	d.Unlock()
+
+	kept := []*core.ErrorMessage{}
+	for _, l := range letters {
+		// the inputs of a letter from a composite belong to one of the
+		// composite's internal blocks, so they can't be replayed.
+		b, ok := s.blocks[l.Block]
+		if !ok || b.composite != nil || b.Block.Replay(l.Inputs) != nil {
+			kept = append(kept, l)
+		}
+	}
+
+	d.Lock()
+	d.Push(kept...)
+	d.Unlock()
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nytlabs/st-core/core"
+)
+
+// the stats of every block that has done some work since the last interval
+// are streamed to websocket clients every statsInterval.
+const statsInterval = 5 * time.Second
+
+// stats returns the statistics of the block. The pins of a composite report
+// the counts of the pins they expose, and the rest of its statistics are the
+// totals of its internal blocks.
+func (bl *BlockLedger) stats() core.BlockStats {
+	if bl.composite == nil {
+		return bl.Block.Stats()
+	}
+
+	c := bl.composite
+	stats := core.BlockStats{
+		In:     make([]uint64, len(c.inputs)),
+		Out:    make([]uint64, len(c.outputs)),
+		Kernel: core.NewHistogram(core.KernelBuckets),
+	}
+	inner := make(map[int]core.BlockStats)
+	for id, b := range c.blocks {
+		bs := b.Stats()
+		inner[id] = bs
+		stats.Errors += bs.Errors
+		stats.Kernel.Add(bs.Kernel)
+		stats.Receiving += bs.Receiving
+		stats.Broadcasting += bs.Broadcasting
+	}
+	for i, pin := range c.inputs {
+		stats.In[i] = inner[pin.Id].In[pin.Route]
+	}
+	for i, pin := range c.outputs {
+		stats.Out[i] = inner[pin.Id].Out[pin.Route]
+	}
+	return stats
+}
+
+// statsRouter periodically broadcasts the stats of the blocks that have been
+// busy, until quit is closed.
+func (s *Server) statsRouter(quit chan struct{}) {
+	seen := make(map[int]uint64) // the activity of each block when it was last broadcast
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+		s.Lock()
+		for id, b := range s.blocks {
+			stats := b.stats()
+			activity := stats.Errors + stats.Kernel.Count
+			for _, in := range stats.In {
+				activity += in
+			}
+			if activity == seen[id] {
+				continue
+			}
+			seen[id] = activity
+			s.websocketBroadcast(Update{Action: INFO, Type: BLOCK, Data: wsBlock{wsStats{wsId{id}, stats}}})
+		}
+		s.Unlock()
+	}
+}
+
+func (s *Server) BlockStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	b, ok := s.blocks[id]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not find block"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, b.stats())
+}
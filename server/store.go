@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// the store keeps an on-disk copy of the running pattern so that it survives
+// a restart of the server.
+//
+// every CREATE, DELETE and UPDATE that the server broadcasts to its websocket
+// clients is also journaled to the store. journaled changes are coalesced for
+// persistDelay, after which the root group is exported and written to disk in
+// its entirety. on start, NewServer reads the file back and rebuilds the
+// pattern using ImportGroup.
+
+const persistDelay = 250 * time.Millisecond
+
+type store struct {
+	path  string
+	dirty chan struct{}
+}
+
+func newStore(path string) *store {
+	return &store{
+		path:  path,
+		dirty: make(chan struct{}, 1),
+	}
+}
+
+// write atomically replaces the pattern on disk with p.
+func (st *store) write(p *Pattern) error {
+	d, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	err = ioutil.WriteFile(tmp, d, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// read returns the pattern on disk. If there is no pattern on disk, read
+// returns nil.
+func (st *store) read() (*Pattern, error) {
+	d, err := ioutil.ReadFile(st.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var p Pattern
+	err = json.Unmarshal(d, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// journal marks the pattern as changed if the update modifies the pattern.
+// journal never blocks, so it is safe to call while holding the server lock.
+func (s *Server) journal(u Update) {
+	if s.store == nil {
+		return
+	}
+	switch u.Action {
+	case CREATE, DELETE, UPDATE:
+	default:
+		return
+	}
+	select {
+	case s.store.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// persistRouter writes the pattern to disk whenever it has been journaled as
+// changed.
+func (s *Server) persistRouter() {
+	for range s.store.dirty {
+		time.Sleep(persistDelay)
+		err := s.Flush()
+		if err != nil {
+			log.Println("could not persist pattern:", err)
+		}
+	}
+}
+
+// Flush writes the current pattern to disk. Flush is a no-op if the server
+// has no store.
+func (s *Server) Flush() error {
+	if s.store == nil {
+		return nil
+	}
+	s.Lock()
+	p, err := s.Export(0)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.store.write(p)
+}
+
+// Restore rebuilds the pattern held on disk into the root group.
+func (s *Server) Restore() error {
+	if s.store == nil {
+		return errors.New("no pattern store configured")
+	}
+
+	p, err := s.store.read()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.importRoot(*p)
+}
+
+// importRoot imports a pattern exported from the root of a server into the
+// root group.
+func (s *Server) importRoot(p Pattern) error {
+	// the root group is exported along with the rest of the pattern. we
+	// don't want to create a new group for it, so it is removed and its
+	// children are attached directly to the root.
+	groups := []Group{}
+	for _, g := range p.Groups {
+		if g.Id != 0 {
+			groups = append(groups, g)
+		}
+	}
+	p.Groups = groups
+
+	_, err := s.ImportGroup(0, p)
+	return err
+}
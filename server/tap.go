@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/nytlabs/st-core/core"
+)
+
+// a tap streams copies of the messages flowing along a connection to the
+// websocket clients that have subscribed to it, without changing the pattern.
+// clients subscribe by sending "tap <connection id>" over the websocket, and
+// unsubscribe with "untap <connection id>".
+//
+// a tap never holds up the connection it is on. messages that arrive faster
+// than the tap's rate are dropped, and messages that are longer than the
+// tap's size when marshalled to JSON are truncated.
+
+const (
+	defaultTapRate = 10   // messages per second
+	defaultTapSize = 1024 // bytes
+)
+
+type ProtoTap struct {
+	Rate int `json:"rate"`
+	Size int `json:"size"`
+}
+
+type TapLedger struct {
+	Connection int `json:"connection"`
+	Rate       int `json:"rate"`
+	Size       int `json:"size"`
+	c          chan core.Message
+	quit       chan struct{}
+}
+
+// a message sent to subscribers of a tap
+type tapMessage struct {
+	connection int
+	data       []byte
+}
+
+// type TAP
+type wsTap struct {
+	Tap interface{} `json:"tap"`
+}
+
+type wsTapMessage struct {
+	wsId
+	Message   string    `json:"message"`
+	Truncated bool      `json:"truncated"`
+	Dropped   int       `json:"dropped"` // messages dropped since the last message
+	Time      time.Time `json:"time"`
+}
+
+// tapped returns the core block, output and connection of a connection.
+func (s *Server) tapped(c *ConnectionLedger) (*core.Block, core.RouteIndex, core.Connection, error) {
+	source, ok := s.blocks[c.Source.Id]
+	if !ok {
+		return nil, 0, nil, errors.New("could not find source block")
+	}
+	target, ok := s.blocks[c.Target.Id]
+	if !ok {
+		return nil, 0, nil, errors.New("could not find target block")
+	}
+	sourceBlock, sourceRoute, err := source.output(c.Source.Route)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	route, err := s.connectionChan(c, target)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return sourceBlock, sourceRoute, route, nil
+}
+
+func (s *Server) CreateTap(id int, p ProtoTap) (*TapLedger, error) {
+	c, ok := s.connections[id]
+	if !ok {
+		return nil, errors.New("could not find connection")
+	}
+
+	if _, ok := s.taps[id]; ok {
+		return nil, errors.New("connection is already tapped")
+	}
+
+	if p.Rate < 0 || p.Size < 0 {
+		return nil, errors.New("tap rate and size must be positive")
+	}
+	if p.Rate == 0 {
+		p.Rate = defaultTapRate
+	}
+	if p.Size == 0 {
+		p.Size = defaultTapSize
+	}
+
+	block, route, conn, err := s.tapped(c)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TapLedger{
+		Connection: id,
+		Rate:       p.Rate,
+		Size:       p.Size,
+		c:          make(chan core.Message, 1),
+		quit:       make(chan struct{}),
+	}
+
+	err = block.Tap(route, conn, t.c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.taps[id] = t
+	go s.tapRouter(t)
+
+	s.websocketBroadcast(Update{Action: CREATE, Type: TAP, Data: wsTap{t}})
+	return t, nil
+}
+
+func (s *Server) DeleteTap(id int) error {
+	t, ok := s.taps[id]
+	if !ok {
+		return errors.New("connection is not tapped")
+	}
+
+	c, ok := s.connections[id]
+	if ok {
+		block, route, conn, err := s.tapped(c)
+		if err != nil {
+			return err
+		}
+		err = block.Tap(route, conn, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	close(t.quit)
+	delete(s.taps, id)
+
+	s.websocketBroadcast(Update{Action: DELETE, Type: TAP, Data: wsTap{wsId{id}}})
+	return nil
+}
+
+// tapRouter sends the messages of a tap on to its subscribers.
+func (s *Server) tapRouter(t *TapLedger) {
+	interval := time.Second / time.Duration(t.Rate)
+	var last time.Time
+	dropped := 0
+	for {
+		select {
+		case m := <-t.c:
+			if time.Since(last) < interval {
+				dropped++
+				continue
+			}
+			last = time.Now()
+
+			d, err := json.Marshal(m)
+			if err != nil {
+				d = []byte(err.Error())
+			}
+			truncated := len(d) > t.Size
+			if truncated {
+				d = truncate(d, t.Size)
+			}
+
+			out, err := json.Marshal(Update{Action: INFO, Type: TAP, Data: wsTap{wsTapMessage{
+				wsId:      wsId{t.Connection},
+				Message:   string(d),
+				Truncated: truncated,
+				Dropped:   dropped,
+				Time:      last,
+			}}})
+			if err != nil {
+				continue
+			}
+			dropped = 0
+			select {
+			case s.tapBroadcast <- tapMessage{t.Connection, out}:
+			case <-t.quit:
+				return
+			}
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// subscribe parses a websocket message asking to subscribe or unsubscribe
+// from a tap. subscribe returns false if the message isn't about taps.
+func (c *socket) subscribe(message []byte) bool {
+	fields := strings.Fields(string(message))
+	if len(fields) != 2 || (fields[0] != "tap" && fields[0] != "untap") {
+		return false
+	}
+	id, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if fields[0] == "tap" {
+		c.taps[id] = struct{}{}
+	} else {
+		delete(c.taps, id)
+	}
+	return true
+}
+
+func (c *socket) subscribed(id int) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.taps[id]
+	return ok
+}
+
+func (s *Server) ConnectionTapHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{"could not read request body"})
+		return
+	}
+
+	var p ProtoTap
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &p)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, Error{"could not read JSON"})
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	t, err := s.CreateTap(id, p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, t)
+}
+
+func (s *Server) ConnectionUntapHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	err = s.DeleteTap(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// truncate shortens d to at most size bytes without splitting a UTF-8 encoded
+// character.
+func truncate(d []byte, size int) []byte {
+	if len(d) <= size {
+		return d
+	}
+	for size > 0 && !utf8.RuneStart(d[size]) {
+		size--
+	}
+	return d[:size]
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/nytlabs/st-core/core"
+)
+
+// the server samples messages that enter the pattern and keeps the hops of
+// the most recent maxTraces traces. every hop is also sent to websocket
+// clients as it is recorded.
+const maxTraces = 1000
+
+type tracer struct {
+	server *Server
+	sample float64 // the fraction of messages that are traced
+	next   core.TraceID
+	traces map[core.TraceID][]core.Hop
+	order  []core.TraceID // oldest first
+	sync.Mutex
+}
+
+func newTracer(s *Server, sample float64) *tracer {
+	return &tracer{
+		server: s,
+		sample: sample,
+		traces: make(map[core.TraceID][]core.Hop),
+	}
+}
+
+func (t *tracer) Start() (core.TraceID, bool) {
+	if t.sample <= 0 || rand.Float64() >= t.sample {
+		return 0, false
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.next++
+	id := t.next
+	t.traces[id] = []core.Hop{}
+	t.order = append(t.order, id)
+	if len(t.order) > maxTraces {
+		delete(t.traces, t.order[0])
+		t.order = t.order[1:]
+	}
+	return id, true
+}
+
+func (t *tracer) Record(h core.Hop) {
+	t.Lock()
+	hops, ok := t.traces[h.Trace]
+	if ok {
+		t.traces[h.Trace] = append(hops, h)
+	}
+	t.Unlock()
+
+	if ok {
+		t.server.websocketBroadcast(Update{Action: INFO, Type: TRACE, Data: wsTrace{h}})
+	}
+}
+
+// Trace returns the hops recorded for a trace, in the order they happened.
+func (t *tracer) Trace(id core.TraceID) ([]core.Hop, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	hops, ok := t.traces[id]
+	if !ok {
+		return nil, errors.New("could not find trace")
+	}
+	return append([]core.Hop{}, hops...), nil
+}
+
+// Traces returns the ids of the traces that are kept, oldest first.
+func (t *tracer) Traces() []core.TraceID {
+	t.Lock()
+	defer t.Unlock()
+	return append([]core.TraceID{}, t.order...)
+}
+
+func (s *Server) TraceIndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, s.tracer.Traces())
+}
+
+func (s *Server) TraceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromMux(mux.Vars(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, err)
+		return
+	}
+
+	hops, err := s.tracer.Trace(core.TraceID(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, Error{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeJSON(w, hops)
+}
@@ -22,6 +22,27 @@ type wsPosition struct {
 	Position Position `json:"position"`
 }
 
+type wsTypeCheck struct {
+	wsId
+	TypeCheck bool `json:"typecheck"`
+}
+
+type wsSync struct {
+	wsId
+	Sync   core.SyncMode `json:"sync"`
+	Window string        `json:"window,omitempty"`
+}
+
+type wsState struct {
+	wsId
+	State string `json:"state"`
+}
+
+type wsStats struct {
+	wsId
+	Stats core.BlockStats `json:"stats"`
+}
+
 // type BLOCK
 type wsBlock struct {
 	Block interface{} `json:"block"`
@@ -37,6 +58,11 @@ type wsSource struct {
 	Source interface{} `json:"source"`
 }
 
+// type MACRO
+type wsMacro struct {
+	Macro interface{} `json:"macro"`
+}
+
 // type LINK
 type wsLink struct {
 	Link interface{} `json:"link"`
@@ -66,6 +92,11 @@ type wsSourceModify struct {
 	Value string `json:"value"`
 }
 
+// type TRACE
+type wsTrace struct {
+	Hop core.Hop `json:"hop"`
+}
+
 //type Info
 type wsInfo struct {
 	wsId
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,6 +27,8 @@ const (
 type socket struct {
 	ws   *websocket.Conn
 	send chan []byte
+	taps map[int]struct{} // the connections whose taps the socket subscribes to
+	sync.Mutex
 }
 
 func (c *socket) write(mt int, payload []byte) error {
@@ -35,9 +39,14 @@ func (c *socket) write(mt int, payload []byte) error {
 func (s *Server) websocketBroadcast(v interface{}) {
 	out, err := json.Marshal(v)
 	if err != nil {
-		panic(err)
+		log.Println("could not broadcast update:", err)
+		return
 	}
 	s.broadcast <- out
+
+	if u, ok := v.(Update); ok {
+		s.journal(u)
+	}
 }
 
 func (s *Server) websocketRouter() {
@@ -46,12 +55,20 @@ func (s *Server) websocketRouter() {
 		select {
 		case c := <-s.addSocket:
 			hub[c] = true
+			atomic.StoreInt32(&s.clients, int32(len(hub)))
 		case c := <-s.delSocket:
 			delete(hub, c)
+			atomic.StoreInt32(&s.clients, int32(len(hub)))
 		case m := <-s.broadcast:
 			for c := range hub {
 				c.write(websocket.TextMessage, m)
 			}
+		case t := <-s.tapBroadcast:
+			for c := range hub {
+				if c.subscribed(t.connection) {
+					c.write(websocket.TextMessage, t.data)
+				}
+			}
 		}
 	}
 }
@@ -65,6 +82,9 @@ func (s *Server) websocketReadPump(c *socket) {
 	c.ws.SetPongHandler(func(string) error { c.ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
 		_, message, err := c.ws.ReadMessage()
+		if c.subscribe(message) {
+			continue
+		}
 		if string(message) == "list" {
 			s.Lock()
 			blocks := s.ListBlocks()
@@ -158,10 +178,11 @@ func (s *Server) websocketReadPump(c *socket) {
 
 		}
 
+		// any other message is ignored, so that the pump is always ready
+		// to read the next one
 		if err != nil {
 			break
 		}
-		s.emitChan <- message
 	}
 }
 
@@ -195,7 +216,7 @@ func (s *Server) UpdateSocketHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 		return
 	}
-	c := &socket{send: make(chan []byte, 256), ws: ws}
+	c := &socket{send: make(chan []byte, 256), ws: ws, taps: make(map[int]struct{})}
 	s.addSocket <- c
 	go s.websocketWritePump(c)
 	go s.websocketReadPump(c)